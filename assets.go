@@ -0,0 +1,269 @@
+package gowebcrawler
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Asset types reported by ClassifyAsset
+const (
+	AssetImage  = "image"
+	AssetScript = "script"
+	AssetStyle  = "style"
+	AssetFont   = "font"
+	AssetOther  = "other"
+)
+
+// An Asset is an asset URL along with the kind of asset it is
+type Asset struct {
+	Url  string
+	Type string
+}
+
+var assetExtensions = map[string]string{
+	".apng":  AssetImage,
+	".avif":  AssetImage,
+	".bmp":   AssetImage,
+	".gif":   AssetImage,
+	".ico":   AssetImage,
+	".jpeg":  AssetImage,
+	".jpg":   AssetImage,
+	".png":   AssetImage,
+	".svg":   AssetImage,
+	".webp":  AssetImage,
+	".js":    AssetScript,
+	".mjs":   AssetScript,
+	".css":   AssetStyle,
+	".eot":   AssetFont,
+	".otf":   AssetFont,
+	".ttf":   AssetFont,
+	".woff":  AssetFont,
+	".woff2": AssetFont,
+}
+
+// Guesses an asset's type from the extension on its URL path
+func ClassifyAsset(assetUrl string) string {
+	p := assetUrl
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+
+	if t, ok := assetExtensions[strings.ToLower(path.Ext(p))]; ok {
+		return t
+	}
+	return AssetOther
+}
+
+// Gets an asset's type from a Content-Type header value
+func ClassifyContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return AssetOther
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return AssetImage
+	case strings.HasPrefix(mediaType, "font/"), strings.Contains(mediaType, "font"):
+		return AssetFont
+	case mediaType == "text/css":
+		return AssetStyle
+	case strings.Contains(mediaType, "javascript"), strings.Contains(mediaType, "ecmascript"):
+		return AssetScript
+	}
+	return AssetOther
+}
+
+// Classifies each asset URL by its extension
+func classifyAssets(assets []string) []Asset {
+	if len(assets) == 0 {
+		return nil
+	}
+
+	typed := make([]Asset, len(assets))
+	for i, a := range assets {
+		typed[i] = Asset{Url: a, Type: ClassifyAsset(a)}
+	}
+	return typed
+}
+
+// VerifiedAssets is a set of asset URLs that answered a HEAD request with
+// a 2xx status code, along with the code and the asset's type. Share one
+// between crawls with WebCrawler.VerifiedAssets so assets already found to be
+// fine aren't checked again. The zero value is ready to use, and it's safe for
+// concurrent use.
+type VerifiedAssets struct {
+	mu     sync.Mutex
+	status map[string]int
+	types  map[string]string
+}
+
+// Gets the status code and type an asset was verified with, if it has been
+func (v *VerifiedAssets) get(assetUrl string) (int, string, bool) {
+	if v == nil {
+		return 0, "", false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	status, ok := v.status[assetUrl]
+	return status, v.types[assetUrl], ok
+}
+
+// Records an asset's status code and type if the code is a 2xx
+func (v *VerifiedAssets) add(assetUrl string, status int, assetType string) {
+	if v == nil || status < 200 || status > 299 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.status == nil {
+		v.status = make(map[string]int)
+		v.types = make(map[string]string)
+	}
+	v.status[assetUrl] = status
+	v.types[assetUrl] = assetType
+}
+
+// Tracks the HEAD requests checking a crawl's assets exist, each unique URL
+// only once. The requests are queued and run by the crawl like page fetches.
+// Only used from the crawl's main loop.
+type assetValidator struct {
+	checked  map[string]bool
+	status   map[string]int
+	types    map[string]string
+	verified *VerifiedAssets
+}
+
+func newAssetValidator(verified *VerifiedAssets) *assetValidator {
+	return &assetValidator{
+		checked:  make(map[string]bool),
+		status:   make(map[string]int),
+		types:    make(map[string]string),
+		verified: verified,
+	}
+}
+
+// Gets any of a page's assets that haven't been checked yet and need a HEAD
+// request, taking the status of those already verified from the shared set
+func (v *assetValidator) unchecked(w WebCrawler, page *Page) []string {
+	var assetUrls []string
+	for _, a := range page.Assets {
+		assetUrl := normalizeAsset(page.Url, a)
+		if v.checked[assetUrl] || w.checkAssetUrl(assetUrl) != nil {
+			continue
+		}
+		v.checked[assetUrl] = true
+
+		if status, assetType, ok := v.verified.get(assetUrl); ok {
+			v.status[assetUrl] = status
+			v.types[assetUrl] = assetType
+			continue
+		}
+		assetUrls = append(assetUrls, assetUrl)
+	}
+	return assetUrls
+}
+
+// Records the result of an asset's HEAD request
+func (v *assetValidator) record(assetUrl string, status int, assetType string) {
+	v.verified.add(assetUrl, status, assetType)
+	v.status[assetUrl] = status
+	v.types[assetUrl] = assetType
+}
+
+// Checks an asset URL is http(s) and on the allowed domain. Unlike pages,
+// assets outside the seed's directory are still checked with
+// ConfineToSeedPath, as sites tend to keep them all somewhere like /static/.
+func (w WebCrawler) checkAssetUrl(url string) error {
+	if !hasAllowedScheme(url) {
+		return ErrUnsupportedScheme
+	}
+	return w.checkDomain(url)
+}
+
+// Gets the status code of a HEAD request, zero if it failed, and the asset's
+// type from the response's Content-Type, or from its extension when that
+// doesn't say
+func headAsset(ctx context.Context, parser *UrlParser, assetUrl string) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", assetUrl, nil)
+	if err != nil {
+		return 0, ClassifyAsset(assetUrl)
+	}
+	parser.setUserAgent(req)
+
+	res, err := parser.client().Do(req)
+	if err != nil {
+		return 0, ClassifyAsset(assetUrl)
+	}
+	res.Body.Close()
+
+	assetType := ClassifyContentType(res.Header.Get("Content-Type"))
+	if assetType == AssetOther {
+		assetType = ClassifyAsset(assetUrl)
+	}
+	return res.StatusCode, assetType
+}
+
+// Gathers each unique asset of a crawl along with the pages using it
+type assetCollector struct {
+	pages map[string][]string
+
+	// The first copy seen of each asset URL as written, shared by every page
+	// that writes it the same way
+	interned map[string]string
+}
+
+func newAssetCollector() *assetCollector {
+	return &assetCollector{
+		pages:    make(map[string][]string),
+		interned: make(map[string]string),
+	}
+}
+
+// Records the page's assets, counting each one once per page
+func (c *assetCollector) add(page *Page) {
+	seen := make(map[string]bool)
+	for _, a := range page.Assets {
+		assetUrl := normalizeAsset(page.Url, a)
+		if !seen[assetUrl] {
+			seen[assetUrl] = true
+			c.pages[assetUrl] = append(c.pages[assetUrl], page.Url)
+		}
+	}
+}
+
+// Swaps a page's asset strings for the copies already held for other pages
+func (c *assetCollector) intern(page *Page) {
+	for i, a := range page.Assets {
+		if s, ok := c.interned[a]; ok {
+			page.Assets[i] = s
+		} else {
+			c.interned[a] = a
+		}
+	}
+}
+
+// Gets every asset seen, sorted by URL, each with the sorted pages using it
+func (c *assetCollector) refs() []AssetRef {
+	refs := make([]AssetRef, 0, len(c.pages))
+	for a, pages := range c.pages {
+		sort.Strings(pages)
+		refs = append(refs, AssetRef{Url: a, Count: len(pages), Pages: pages})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Url < refs[j].Url })
+	return refs
+}
+
+// Gets the URL an asset is tracked under: absolute, without a fragment
+func normalizeAsset(pageUrl string, asset string) string {
+	assetUrl := resolveUrl(pageUrl, strings.TrimSpace(asset))
+	if i := strings.Index(assetUrl, "#"); i >= 0 {
+		assetUrl = assetUrl[:i]
+	}
+	return assetUrl
+}
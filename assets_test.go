@@ -0,0 +1,294 @@
+package gowebcrawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func TestClassifyAsset(t *testing.T) {
+	cases := map[string]string{
+		"/img.png":                      AssetImage,
+		"/photos/Cat.JPG?size=large":    AssetImage,
+		"icon.svg#sprite":               AssetImage,
+		"//cdn.example.com/app.min.js":  AssetScript,
+		"/assets/style.css":             AssetStyle,
+		"/fonts/body.woff2":             AssetFont,
+		"/fonts/heading.ttf":            AssetFont,
+		"/feed.xml":                     AssetOther,
+		"/no-extension":                 AssetOther,
+		"http://example.com/styles.css": AssetStyle,
+	}
+
+	for url, expected := range cases {
+		assert.Equal(t, expected, ClassifyAsset(url), "Wrong type for %s", url)
+	}
+}
+
+func TestParsePageFlagsMixedContent(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadFile(path.Join(BasePath, "mixed_content.html"))
+		w.Write(body)
+	})
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+
+	parser := UrlParser{Client: secure.Client()}
+	page, err := parser.ParsePage(secure.URL)
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Equal(t, []string{
+		"http://cdn.example.com/app.js",
+		"http://images.example.com/banner.png",
+	}, page.MixedContent, "Didn't flag the insecure assets")
+
+	page, err = parser.ParsePage(plain.URL)
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Nil(t, page.MixedContent, "Flagged assets on an http page")
+}
+
+func TestClassifyContentType(t *testing.T) {
+	cases := map[string]string{
+		"image/png":                      AssetImage,
+		"application/javascript":         AssetScript,
+		"text/javascript; charset=utf-8": AssetScript,
+		"text/css":                       AssetStyle,
+		"font/woff2":                     AssetFont,
+		"application/font-woff":          AssetFont,
+		"text/html":                      AssetOther,
+		"":                               AssetOther,
+	}
+
+	for contentType, expected := range cases {
+		assert.Equal(t, expected, ClassifyContentType(contentType), "Wrong type for %s", contentType)
+	}
+}
+
+func TestCrawlClassifiesAssets(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := WebCrawler{
+		Parser:  &UrlParser{ClassifyAssets: true},
+		RootUrl: ts.URL,
+	}
+
+	root := crawlToPage(t, crawler, "/assets.html")
+
+	expected := []Asset{
+		{Url: "/assets/style.css", Type: AssetStyle},
+		{Url: "/img.png", Type: AssetImage},
+		{Url: "//ajax.googleapis.com/ajax/libs/jquery/1.7.1/jquery.min.js", Type: AssetScript},
+	}
+	assert.Equal(t, expected, root.TypedAssets, "Assets weren't classified")
+	assert.Len(t, root.Assets, 3, "Plain assets are missing")
+}
+
+func TestRunValidatesAssets(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	var mu sync.Mutex
+	methods := map[string]string{}
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods[r.URL.Path] = r.Method
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+
+	crawler := getCrawler(ts.URL)
+	crawler.ValidateAssets = true
+	result, err := crawler.Run("/broken_assets.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+
+	expected := map[string]int{
+		fmt.Sprint(ts.URL, "/static/site.css"):    http.StatusOK,
+		fmt.Sprint(ts.URL, "/static/missing.png"): http.StatusNotFound,
+	}
+	assert.Equal(t, expected, result.AssetStatus, "Didn't record asset statuses")
+	assert.Equal(t, map[string]string{
+		fmt.Sprint(ts.URL, "/static/site.css"):    AssetStyle,
+		fmt.Sprint(ts.URL, "/static/missing.png"): AssetImage,
+	}, result.AssetTypes, "Didn't record asset types")
+	assert.Equal(t, "HEAD", methods["/static/site.css"], "Asset wasn't checked with HEAD")
+	assert.Len(t, result.Root.Children, 0, "Assets were crawled as pages")
+}
+
+func TestRunValidatesAssetsByContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<img src="/logo"><script src="/app.css"></script>`))
+		case "/logo":
+			w.Header().Set("Content-Type", "image/svg+xml")
+		case "/app.css":
+			w.Header().Set("Content-Type", "application/javascript")
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.ValidateAssets = true
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]string{
+		fmt.Sprint(ts.URL, "/logo"):    AssetImage,
+		fmt.Sprint(ts.URL, "/app.css"): AssetScript,
+	}, result.AssetTypes, "Didn't type assets by their Content-Type")
+}
+
+func TestRunValidatesAssetsWithinCrawlLimits(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+
+		if r.URL.Path == "/blog/" {
+			w.Write([]byte(`<img src="/static/1.png"><img src="/static/2.png"><img src="/static/3.png">`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.ValidateAssets = true
+	crawler.ConfineToSeedPath = true
+	crawler.MaxConcurrency = 1
+	crawler.FetchLimit = 1
+	result, err := crawler.Run("/blog/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Len(t, result.AssetStatus, 3, "Assets outside the seed's directory or past FetchLimit weren't checked")
+	assert.Equal(t, 1, most, "Asset checks ran past MaxConcurrency")
+	assert.Equal(t, 4, result.Attempts, "Asset checks weren't counted as attempts")
+
+	crawler.MaxAttempts = 2
+	result, err = crawler.Run("/blog/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Len(t, result.AssetStatus, 1, "Asset checks ran past MaxAttempts")
+}
+
+func TestCrawlVerifiedAssetsKeepTheirType(t *testing.T) {
+	heads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<img src="/logo">`))
+		case "/logo":
+			heads++
+			w.Header().Set("Content-Type", "image/svg+xml")
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.ValidateAssets = true
+	crawler.VerifiedAssets = &VerifiedAssets{}
+	_, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 1, heads, "Verified asset was checked again")
+	assert.Equal(t, map[string]string{fmt.Sprint(ts.URL, "/logo"): AssetImage}, result.AssetTypes, "Verified asset lost the type from its Content-Type")
+}
+
+func TestCrawlDedupAssets(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.DedupAssets = true
+	crawler.ReleasePages = true
+	result, err := crawler.Run("/shared_assets/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	one, two := fmt.Sprint(ts.URL, "/shared_assets/1.html"), fmt.Sprint(ts.URL, "/shared_assets/2.html")
+	assert.Equal(t, []AssetRef{
+		{Url: fmt.Sprint(ts.URL, "/shared_assets/app.js"), Count: 1, Pages: []string{two}},
+		{Url: fmt.Sprint(ts.URL, "/shared_assets/logo.png"), Count: 1, Pages: []string{one}},
+		{Url: fmt.Sprint(ts.URL, "/static/site.css"), Count: 2, Pages: []string{one, two}},
+	}, result.Assets, "Shared assets weren't listed once each")
+
+	j, err := result.AssetsJSON()
+	assert.Nil(t, err, "Got an error from AssetsJSON")
+	var refs []AssetRef
+	assert.Nil(t, json.Unmarshal(j, &refs), "Didn't get a JSON asset list")
+	assert.Equal(t, result.Assets, refs, "AssetsJSON didn't use the gathered assets")
+}
+
+func TestCrawlDedupAssetsSharesStrings(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.DedupAssets = true
+	root := crawlToPage(t, crawler, "/shared_assets/1.html")
+
+	two := root.Children[fmt.Sprint(ts.URL, "/shared_assets/2.html")]
+	assert.Equal(t, "/static/site.css", root.Assets[0], "Assets weren't kept as written")
+	assert.Equal(t, unsafe.StringData(root.Assets[0]), unsafe.StringData(two.Assets[0]), "Pages don't share the asset string")
+}
+
+func TestCrawlValidatesSharedAssetsOnce(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	var mu sync.Mutex
+	heads := map[string]int{}
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			mu.Lock()
+			heads[r.URL.Path]++
+			mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	crawler := getCrawler(ts.URL)
+	crawler.ValidateAssets = true
+	crawler.VerifiedAssets = &VerifiedAssets{}
+	result, err := crawler.Run("/shared_assets/1.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]int{
+		"/static/site.css":        1,
+		"/shared_assets/logo.png": 1,
+		"/shared_assets/app.js":   1,
+	}, heads, "Shared assets weren't checked once each")
+
+	// Only assets that were fine are skipped next time
+	heads = map[string]int{}
+	again, err := crawler.Run("/shared_assets/1.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]int{
+		"/shared_assets/logo.png": 1,
+		"/shared_assets/app.js":   1,
+	}, heads, "Verified assets were checked again")
+	assert.Equal(t, result.AssetStatus, again.AssetStatus, "Skipped assets lost their status")
+}
@@ -0,0 +1,105 @@
+package gowebcrawler
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// PageCache is an in-memory cache of parsed pages keyed by URL, so a page
+// that's crawled again is taken from memory instead of being fetched and
+// parsed again. It holds at most its size in pages, dropping the least
+// recently used first. Share one between crawls with WebCrawler.PageCache
+// to reuse pages across runs in the same process. It's safe for concurrent use.
+type PageCache struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List
+	pages map[string]*list.Element
+}
+
+// A page in a PageCache's order list
+type cacheEntry struct {
+	url  string
+	page *Page
+}
+
+// Makes a PageCache holding up to size pages
+func NewPageCache(size int) *PageCache {
+	return &PageCache{
+		size:  size,
+		order: list.New(),
+		pages: make(map[string]*list.Element),
+	}
+}
+
+// Len gets the number of pages in the cache
+func (c *PageCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Gets a copy of the page cached for a URL, marking it as recently used
+func (c *PageCache) get(url string) (*Page, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.pages[cacheKey(url)]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return copyPage(e.Value.(*cacheEntry).page), true
+}
+
+// Caches a copy of the page for a URL, dropping the least recently used
+// page if the cache is full
+func (c *PageCache) add(url string, page *Page) {
+	if c == nil || c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(url)
+	if e, ok := c.pages[key]; ok {
+		e.Value.(*cacheEntry).page = copyPage(page)
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.pages[key] = c.order.PushFront(&cacheEntry{url: key, page: copyPage(page)})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.pages, oldest.Value.(*cacheEntry).url)
+	}
+}
+
+// Gets the key a URL is cached under: cleaned up and without its fragment
+func cacheKey(url string) string {
+	key := cleanUrl(url)
+	if i := strings.Index(key, "#"); i >= 0 {
+		key = key[:i]
+	}
+	return key
+}
+
+// Copies a page without its place in the tree, with its own link and asset
+// lists so the copy can be changed without affecting the original
+func copyPage(p *Page) *Page {
+	c := *p
+	c.parent = nil
+	c.Children = make(map[string]*Page)
+	c.Links = append([]string(nil), p.Links...)
+	c.Assets = append([]string(nil), p.Assets...)
+	return &c
+}
@@ -0,0 +1,81 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPageCacheDropsLeastRecentlyUsed(t *testing.T) {
+	cache := NewPageCache(2)
+	cache.add("http://example.com/a", &Page{Url: "http://example.com/a", Links: []string{"/b"}})
+	cache.add("http://example.com/b", &Page{Url: "http://example.com/b"})
+
+	a, ok := cache.get("http://EXAMPLE.com/a#top")
+	if assert.True(t, ok, "Didn't find the page under its normalized URL") {
+		assert.Equal(t, []string{"/b"}, a.Links, "Didn't cache the page's links")
+		a.Links[0] = "/changed"
+		a.Children["x"] = nil
+	}
+
+	cache.add("http://example.com/c", &Page{Url: "http://example.com/c"})
+	assert.Equal(t, 2, cache.Len(), "Went over the cache size")
+
+	_, ok = cache.get("http://example.com/b")
+	assert.False(t, ok, "Kept the least recently used page")
+
+	a, ok = cache.get("http://example.com/a")
+	if assert.True(t, ok, "Dropped a recently used page") {
+		assert.Equal(t, []string{"/b"}, a.Links, "Changing a copy changed the cached page")
+		assert.Empty(t, a.Children, "Changing a copy changed the cached page")
+	}
+
+	var none *PageCache
+	none.add("http://example.com/a", &Page{})
+	_, ok = none.get("http://example.com/a")
+	assert.False(t, ok, "Nil cache found a page")
+}
+
+func TestCrawlPageCacheAvoidsRefetching(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.PageCache = NewPageCache(10)
+	first := crawlToPage(t, crawler, "/circular/1.html")
+
+	assert.Equal(t, 3, *requestCount, "Didn't make the right amount of requests")
+	assert.Equal(t, 3, crawler.PageCache.Len(), "Didn't cache every page")
+
+	second := crawlToPage(t, crawler, "/circular/1.html")
+
+	assert.Equal(t, 3, *requestCount, "Fetched cached pages again")
+	assert.Equal(t, first.Links, second.Links, "Cached page lost its links")
+	assert.Contains(t, second.Children, fmt.Sprint(ts.URL, "/circular/2.html"), "Cached pages weren't added to the tree")
+
+	// A cache made from CacheSize only lasts for one crawl
+	crawler.PageCache = nil
+	crawler.CacheSize = 10
+	crawlToPage(t, crawler, "/circular/1.html")
+	assert.Equal(t, 6, *requestCount, "Reused a CacheSize cache between crawls")
+}
+
+func TestCrawlPageCacheHitsAreNotCounted(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.PageCache = NewPageCache(10)
+	first, err := crawler.Run("/circular/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 3, first.Attempts, "Didn't count the requests made")
+
+	// Nothing is downloaded, so the byte limit is never reached
+	crawler.MaxTotalBytes = 1
+	second, err := crawler.Run("/circular/1.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 3, *requestCount, "Fetched cached pages again")
+	assert.Equal(t, 0, second.Attempts, "Counted cache hits as attempts")
+	assert.Len(t, second.Root.Flatten(), 3, "Cache hits counted towards MaxTotalBytes")
+}
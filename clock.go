@@ -0,0 +1,106 @@
+package gowebcrawler
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and waits. Crawls use the system clock unless
+// WebCrawler.Clock is set, e.g. to a FakeClock so tests of delays and
+// timeouts don't have to really wait.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// The system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+// A FakeClock is a Clock that only moves when told to, firing any waits that
+// are due. The zero value starts at the zero time.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+// A pending After or Sleep on a FakeClock
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// Gets a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Gets a channel that receives the time once the clock has been moved on by d
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), c: ch})
+	c.signal().Broadcast()
+	return ch
+}
+
+// Blocks until the clock has been moved on by d
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Moves the clock on by d, firing every wait that's now due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+// Blocks until at least n waits are pending, so a test knows the code it's
+// driving has got as far as waiting before it advances the clock
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.signal().Wait()
+	}
+}
+
+// Gets the condition signalled when a wait is added, creating it if needed.
+// Must be called with mu held.
+func (c *FakeClock) signal() *sync.Cond {
+	if c.cond == nil {
+		c.cond = sync.NewCond(&c.mu)
+	}
+	return c.cond
+}
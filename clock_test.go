@@ -0,0 +1,149 @@
+package gowebcrawler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	fired := clock.After(time.Second)
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-fired:
+		t.Fatal("Wait fired early")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-fired, "Wait didn't fire once due")
+	assert.Equal(t, start.Add(time.Second), clock.Now(), "Clock didn't move")
+
+	done := make(chan bool)
+	go func() {
+		clock.Sleep(time.Minute)
+		close(done)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-done
+}
+
+func TestCrawlRetryDelayUsesClock(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []time.Time
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/flaky">`))
+		case "/flaky":
+			mu.Lock()
+			defer mu.Unlock()
+			if attempts = append(attempts, clock.Now()); len(attempts) < 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Clock = clock
+	crawler.MaxRetries = 1
+	crawler.RetryDelay = time.Hour
+
+	done := make(chan *CrawlResult)
+	go func() {
+		result, _ := crawler.Run("/")
+		done <- result
+	}()
+
+	// The retry is waiting on the clock, which hasn't moved
+	clock.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("Crawl finished without waiting for the retry")
+	default:
+	}
+
+	clock.Advance(time.Hour)
+	result := <-done
+
+	assert.Len(t, attempts, 2, "Didn't retry the flaky page")
+	assert.Equal(t, time.Hour, attempts[1].Sub(attempts[0]), "Retry wasn't spaced by RetryDelay")
+	assert.Equal(t, attempts[0], result.CrawledAt, "CrawledAt didn't come from the clock")
+	assert.Empty(t, result.DeadLinks, "Flaky page wasn't fetched on retry")
+}
+
+func TestCrawlDelaySpacesRequestsToAHost(t *testing.T) {
+	var mu sync.Mutex
+	var requests []time.Time
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, clock.Now())
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/1"><a href="/2"><a href="/3">`))
+		}
+	}))
+	defer ts.Close()
+	requested := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requests)
+	}
+
+	crawler := getCrawler(ts.URL)
+	crawler.Clock = clock
+	crawler.CrawlDelay = 10 * time.Second
+
+	done := make(chan error)
+	go func() {
+		_, err := crawler.Run("/")
+		done <- err
+	}()
+
+	// Every page after the seed is waiting its turn on the clock
+	clock.BlockUntil(3)
+	for i := 2; i <= 4; i++ {
+		clock.Advance(10 * time.Second)
+		for deadline := time.Now().Add(5 * time.Second); requested() < i && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	assert.Nil(t, <-done, "Got an error from Run")
+	if assert.Len(t, requests, 4, "Didn't fetch every page") {
+		for i := 1; i < len(requests); i++ {
+			assert.Equal(t, 10*time.Second, requests[i].Sub(requests[i-1]), "Requests weren't spaced by CrawlDelay")
+		}
+	}
+}
+
+func TestCrawlParseTimeoutUsesClock(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat(`<div><a href="/"><img src="/img.png"></a></div>`, 10000)))
+	}))
+	defer ts.Close()
+
+	// The fake clock never moves, so however long parsing really takes it
+	// can't run past the timeout
+	crawler := getCrawler(ts.URL)
+	crawler.Clock = NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	crawler.Parser.ParseTimeout = time.Nanosecond
+
+	root := crawlToPage(t, crawler, "/")
+
+	assert.Empty(t, root.Error, "Parsing timed out on the system clock")
+	assert.Len(t, root.Assets, 10000, "Didn't parse the whole page")
+}
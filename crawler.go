@@ -2,13 +2,74 @@
 package gowebcrawler
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
+// ErrUnsupportedScheme is returned when asked to fetch a URL that isn't http or https
+var ErrUnsupportedScheme = errors.New("Unsupported URL scheme, only http and https are allowed")
+
+// ErrParse is wrapped by errors for pages that were downloaded but couldn't be
+// parsed, to tell them apart from pages that couldn't be downloaded
+var ErrParse = errors.New("Couldn't parse page")
+
+// ErrShortBody is returned when a page's body is shorter than
+// WebCrawler.MinBodyBytes, which is retried like a server error
+var ErrShortBody = errors.New("Page body is too short")
+
+// ErrIdleTimeout is returned along with the partial result when no page
+// finishes within WebCrawler.IdleTimeout
+var ErrIdleTimeout = errors.New("Crawl stalled, no page finished within the idle timeout")
+
+// ErrCrawlTimeout is returned by CrawlWithTimeout when the crawl runs out of
+// time. It wraps context.DeadlineExceeded.
+var ErrCrawlTimeout = fmt.Errorf("Crawl timed out: %w", context.DeadlineExceeded)
+
+// ErrTLSVersion is returned when a server can't or won't use at least
+// WebCrawler.MinTLSVersion
+var ErrTLSVersion = errors.New("Server doesn't support the minimum TLS version")
+
+// ErrOffDomainRedirect is returned when a page redirects outside of the
+// crawl's allowed domain and WebCrawler.BlockOffDomainRedirects is set
+var ErrOffDomainRedirect = errors.New("Redirected outside of allowed domain")
+
+// ErrParseTimeout is returned when parsing a page takes longer than UrlParser.ParseTimeout
+var ErrParseTimeout = fmt.Errorf("%w, timed out", ErrParse)
+
+// A StatusError is returned when a page is fetched with a status code
+// that isn't accepted as a success
+type StatusError struct {
+	Code int
+	Url  string
+
+	// The start of the response body, when UrlParser.CaptureErrorBody is set
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("Got a %d status code when getting URL [%s], body: %q", e.Code, e.Url, e.Body)
+	}
+	return fmt.Sprintf("Got a %d status code when getting URL [%s]", e.Code, e.Url)
+}
+
 // A Page represents a web page's relation to other pages and the
 // data needed to make a site map showing assets it depends on
 type Page struct {
@@ -17,6 +78,97 @@ type Page struct {
 	Links    []string
 	Children map[string]*Page
 	parent   *Page
+
+	// Hex SHA-256 of the fetched body, for spotting changes between crawls
+	ContentHash string
+
+	// Response headers selected by UrlParser.RecordHeaders
+	Headers map[string]string `json:",omitempty"`
+
+	// Assets along with their type, when UrlParser.ClassifyAssets is set
+	TypedAssets []Asset `json:",omitempty"`
+
+	// Alternate versions of the page from <link rel="alternate" hreflang>,
+	// by language. They're recorded but not crawled.
+	Alternates map[string]string `json:",omitempty"`
+
+	// Why the page couldn't be fetched, if it couldn't
+	Error string `json:",omitempty"`
+
+	// Order the page was processed in during the crawl, starting from 0 for the root
+	Seq int
+
+	// Directives from the page's <meta name="robots">, and whether they ask for
+	// it not to be indexed when WebCrawler.RespectMetaRobots is set
+	Robots  []string `json:",omitempty"`
+	NoIndex bool     `json:",omitempty"`
+
+	// The raw response body, when UrlParser.StoreBody is set
+	Body string `json:",omitempty"`
+
+	// Every URL the request went through when it was redirected, starting
+	// with the one requested and ending with the one that served the page
+	RedirectChain []string `json:",omitempty"`
+
+	// How long each stage of the fetch took, when UrlParser.TraceTimings is set
+	Timings *Timings `json:",omitempty"`
+
+	// Number of bytes in the response body
+	Size int64
+
+	// Next and previous pages of a paginated listing, from rel="next" and rel="prev"
+	Next string `json:",omitempty"`
+	Prev string `json:",omitempty"`
+
+	// Assets loaded over plain http by a page served over https
+	MixedContent []string `json:",omitempty"`
+
+	// The TLS version and certificate the page was served with, when
+	// UrlParser.CaptureTLSInfo is set and it was fetched over https
+	TLS *TLSInfo `json:",omitempty"`
+
+	// From the Last-Modified response header, if there was a valid one
+	LastModified *time.Time `json:",omitempty"`
+
+	// The page's <a> links along with their anchor text, when
+	// UrlParser.RecordLinkText is set
+	TextLinks []Link `json:",omitempty"`
+
+	// Fragment-only links on the page, such as single page app routes like
+	// "#/about", when UrlParser.RecordFragments is set
+	Fragments []string `json:",omitempty"`
+
+	// Fewest links followed from the root to get to the page, set by
+	// CrawlResult.ComputeClickDepths
+	ClickDepth int `json:",omitempty"`
+
+	// The page's links made absolute, each flagged with whether it's in the
+	// crawl's scope, when WebCrawler.RecordLinkScope is set
+	ScopedLinks []ScopedLink `json:",omitempty"`
+
+	// Open Graph and Twitter Card properties for social previews, such as
+	// og:title and twitter:card, when UrlParser.RecordOpenGraph is set
+	OpenGraph map[string]string `json:",omitempty"`
+
+	// Entries from the response's HTTP Link headers, such as pagination and
+	// preload links that aren't in the HTML
+	LinkHeaders []HeaderLink `json:",omitempty"`
+
+	// How the page's URL was found, such as SourceLink for an <a>,
+	// SourceCanonical for a <link rel="canonical"> or SourceRedirect when
+	// fetching it was redirected, when WebCrawler.RecordSources is set
+	Source string `json:",omitempty"`
+
+	// Stylesheets to fetch for their assets when UrlParser.ParseCSSAssets is set
+	stylesheets []string
+
+	// Requests made and body bytes downloaded fetching the stylesheets, which
+	// count towards the crawl's limits
+	cssRequests int
+	cssBytes    int64
+
+	// How each link found some way other than an <a> was found, for Source
+	linkSources map[string]string
 }
 
 type Parser interface {
@@ -24,7 +176,112 @@ type Parser interface {
 }
 
 // UrlParser implements Parser to extract relevant data from a page at a given URL
-type UrlParser struct{}
+type UrlParser struct {
+	// Client used for requests, http.DefaultClient when nil
+	Client *http.Client
+
+	// Treat the target of a <meta http-equiv="refresh"> redirect as a link
+	FollowMetaRefresh bool
+
+	// Treat the rel="next" page of a paginated listing as a link, so every
+	// page of the listing is crawled even without regular links between them.
+	// Same host rel="next" and rel="prev" entries in HTTP Link headers are
+	// followed too.
+	FollowPagination bool
+
+	// Treat the target of a <link rel="canonical"> as a link, so canonical
+	// pages are crawled even when nothing else links to them
+	FollowCanonical bool
+
+	// User-Agent header sent with each request, Go's default when empty. When
+	// UserAgents is set each request picks one of them at random instead.
+	UserAgent  string
+	UserAgents []string
+
+	// Status codes treated as a successful fetch. Any 2xx code is accepted when empty.
+	AcceptedStatusCodes []int
+
+	// Response headers to record on each Page, e.g. "Cache-Control"
+	RecordHeaders []string
+
+	// Also treat image map <area href> and GET <form action> targets as links
+	FollowAreaLinks   bool
+	FollowFormActions bool
+
+	// Collect each page's assets, which happens when nil. Set to point at
+	// false to skip them for crawls that only care about the link structure.
+	CollectAssets *bool
+
+	// Also record each asset with its type in Page.TypedAssets
+	ClassifyAssets bool
+
+	// Maximum time to spend parsing a page's HTML, unlimited when zero
+	ParseTimeout time.Duration
+
+	// Only parse HTML responses, going by the Content-Type header or by
+	// sniffing the body when there isn't one. Anything else becomes a page
+	// without links or assets.
+	HTMLOnly bool
+
+	// Record how long DNS, connecting, the TLS handshake and waiting for the
+	// response took in Page.Timings. Adds a little overhead to each request.
+	TraceTimings bool
+
+	// Record the TLS version and certificate of each https page in Page.TLS
+	CaptureTLSInfo bool
+
+	// Keep each page's raw body in Page.Body. Off by default as it means
+	// holding every page of the site in memory.
+	StoreBody bool
+
+	// Trim whitespace and control characters around links and assets, remove
+	// tabs and newlines inside them, encode any other spaces and lowercase
+	// their host, so messy markup doesn't cause duplicates or failed fetches
+	CleanUrls bool
+
+	// Move fragment-only links like "#/about" out of Page.Links into
+	// Page.Fragments, so they're recorded without ever being fetched
+	RecordFragments bool
+
+	// Also record each <a> link's anchor text in Page.TextLinks
+	RecordLinkText bool
+
+	// Also treat same-host "url" and "@id" values in JSON-LD structured data
+	// (<script type="application/ld+json">) as links
+	ParseJSONLD bool
+
+	// Picks from UserAgents for a crawl with WebCrawler.RandSeed set
+	rand *lockedRand
+
+	// Times ParseTimeout, for a crawl with WebCrawler.Clock set
+	clock Clock
+
+	// Rejects stylesheets outside a crawl's allowed domain before they're
+	// fetched for ParseCSSAssets
+	cssScope func(string) error
+
+	// Note how links were found, for a crawl with WebCrawler.RecordSources set
+	recordSources bool
+
+	// Fetch each page's stylesheets and add the images, fonts and imported
+	// stylesheets they reference with url() and @import to its assets, along
+	// with those in inline <style> elements. Costs an extra request per
+	// stylesheet on every page that uses it. In a crawl, stylesheets off the
+	// allowed domain aren't fetched, and the requests count towards
+	// FetchLimit, MaxAttempts and MaxTotalBytes like page fetches.
+	ParseCSSAssets bool
+
+	// Record the og:title, og:image, og:url and twitter:card meta tags of
+	// each page in Page.OpenGraph
+	RecordOpenGraph bool
+
+	// Keep the first ErrorBodyBytes of the body of responses with a status
+	// code that isn't accepted in StatusError.Body, so the error shows what
+	// the server sent back, such as a firewall's block page. ErrorBodyBytes
+	// defaults to 512.
+	CaptureErrorBody bool
+	ErrorBodyBytes   int
+}
 
 type Crawler interface {
 	Crawl(string, parser Parser) ([]byte, error)
@@ -38,153 +295,1785 @@ type WebCrawler struct {
 	Parser     *UrlParser
 	RootUrl    string
 	FetchLimit int
+
+	// Optional hook run on every page before it's stored in the tree. It may
+	// modify or replace the page, or return nil to drop it (and its links).
+	PageHook func(*Page) *Page
+
+	// HTTP method and body used for the seed request only, e.g. to get past
+	// a form gate with a POST. Links found from there are always fetched with GET.
+	// SeedContentType defaults to a url-encoded form when SeedBody is set.
+	SeedMethod      string
+	SeedBody        []byte
+	SeedContentType string
+
+	// Optional hook run before anything is fetched, given the client the crawl
+	// will use, e.g. to log in and fill its cookie jar. The crawl is aborted if it
+	// returns an error. When the client has no cookie jar, one is added.
+	Prepare func(client *http.Client) error
+
+	// Don't fail the crawl when the seed page can't be fetched, instead return
+	// a site map with just the seed page and its Error set
+	ContinueOnRootError bool
+
+	// Stop launching new fetches once this many body bytes have been
+	// downloaded in total, unlimited when zero. Pages taken from the page
+	// cache aren't downloaded, so don't count.
+	MaxTotalBytes int64
+
+	// Count only successful fetches towards FetchLimit, so the crawl keeps
+	// going until it has that many good pages. By default every attempted
+	// fetch counts, whether it failed or not.
+	FetchLimitCountsSuccesses bool
+
+	// Treat URLs ending in an index file as the same page as their directory,
+	// so /dir/ and /dir/index.html are only fetched once. IndexFiles defaults to
+	// index.html, index.htm and default.html.
+	CollapseIndexPages bool
+	IndexFiles         []string
+
+	// Add pages that couldn't be fetched to the tree under the page linking
+	// to them, with their Error set and no children. Links that were never
+	// fetched, like those off the allowed domain, aren't added.
+	IncludeFailedPages bool
+
+	// Most fetches to have running at once, unlimited when zero
+	MaxConcurrency int
+
+	// Start with one fetch at a time and raise the limit steadily to
+	// MaxConcurrency over this long, so servers aren't hit at full speed
+	// straight away. Needs MaxConcurrency to be set.
+	RampUp time.Duration
+
+	// Wait a random time up to Jitter before each fetch after the seed, so
+	// pages with lots of links don't send a burst of requests all at once
+	Jitter time.Duration
+
+	// Wait at least this long between starting requests to the same host,
+	// like the Crawl-delay directive in robots.txt. Pages taken from the page
+	// cache aren't held back. No delay when zero.
+	CrawlDelay time.Duration
+
+	// Seed for the crawl's random choices, such as Jitter delays and which of
+	// the parser's UserAgents is sent, so runs can be repeated exactly. A
+	// different seed is used for each crawl when zero.
+	RandSeed int64
+
+	// Retry fetches that fail with a network error, a 5xx or a 429 up to
+	// MaxRetries times, waiting RetryDelay before each retry
+	MaxRetries int
+	RetryDelay time.Duration
+
+	// Treat bodies shorter than this as a failed fetch, so an empty or truncated
+	// response from a glitching server is retried. No minimum when zero.
+	MinBodyBytes int64
+
+	// Decides which failed fetches are retried instead of the default above.
+	// statusCode is zero when the fetch failed without a response. Fetches
+	// cancelled through the context are never retried.
+	RetryableFunc func(statusCode int, err error) bool
+
+	// Count retries towards FetchLimit and MaxTotalBytes like any other
+	// fetch, so a flaky site can't go over budget through retries. When
+	// false, retries are always made even once the limits have been hit.
+	RetriesCountTowardsLimits bool
+
+	// Stop launching fetches once this many requests have been made in
+	// total, counting every retry and the seed, unlike FetchLimit which
+	// counts URLs. Links skipped without a request and pages taken from the
+	// page cache don't count. Unlimited when zero.
+	MaxAttempts int
+
+	// After HostErrorThreshold failed fetches in a row from one host, wait
+	// HostCooldown before fetching anything else from it, while other hosts
+	// carry on. Only failures worth retrying count, see MaxRetries and
+	// RetryableFunc.
+	HostErrorThreshold int
+	HostCooldown       time.Duration
+
+	// Optional hook deciding whether to fetch each link found, given its
+	// absolute URL, its depth (the root is at 0) and the page it was found on.
+	// It's asked before links are checked against the visited set, so it sees
+	// every link, and skipped links don't count towards any limit.
+	ShouldFetch func(url string, depth int, parent *Page) bool
+
+	// Where to keep track of URLs already seen, an in-memory set by default
+	Visited Visited
+
+	// URLs or paths to treat as already crawled, e.g. from a previous site map
+	// (see LoadVisited), so only new pages are fetched. The seed is always fetched.
+	PreVisited []string
+
+	// Connect to these addresses instead of looking the host up, like /etc/hosts.
+	// Keys are a host or host:port, values an IP or IP:port.
+	HostOverrides map[string]string
+
+	// Give up on a request when the server hasn't started responding this
+	// long after it was sent, so hung servers are abandoned quickly without
+	// limiting how long a large body takes to download. The wait is counted
+	// as a network error, so it's retried. No limit when zero. Only applies
+	// when the parser's client uses an *http.Transport (or the default).
+	ResponseHeaderTimeout time.Duration
+
+	// Answer HTTP Digest auth challenges with these credentials. Each host
+	// that asks is sent a challenge response with every later request.
+	DigestUsername string
+	DigestPassword string
+
+	// Refuse to fetch anything over a TLS version older than this, e.g.
+	// tls.VersionTLS12. Such fetches fail with ErrTLSVersion. Any version Go
+	// supports is allowed when zero.
+	MinTLSVersion uint16
+
+	// Called to get a token sent as "Authorization: Bearer" with every request.
+	// The token is reused until a request gets a 401, then replaced with a new one.
+	TokenProvider func() (string, error)
+
+	// Check each unique asset in the allowed domain exists with a HEAD request.
+	// Assets are never parsed or crawled, and ConfineToSeedPath doesn't apply
+	// to them. The requests are run like page fetches, so MaxConcurrency,
+	// CrawlDelay and MaxAttempts hold them back too, though FetchLimit only
+	// counts pages. See CrawlResult.AssetStatus and CrawlResult.AssetTypes.
+	ValidateAssets bool
+
+	// Assets already verified with a 2xx, shared between crawls so they
+	// aren't checked again by ValidateAssets. Within a crawl each asset is
+	// only checked once either way.
+	VerifiedAssets *VerifiedAssets
+
+	// Fetch at most this many pages at each depth, unlimited when zero. The root
+	// is at depth 0. When set, the queue is kept in breadth-first order so each
+	// level's budget goes to the links found first.
+	MaxPerDepth int
+
+	// Only crawl pages under the seed's directory, e.g. /docs/ for a seed of /docs/intro
+	ConfineToSeedPath bool
+
+	// Crawl every page on the same site as RootUrl, e.g. blog.example.com
+	// from www.example.com, rather than only URLs starting with RootUrl.
+	// Sites are told apart using the public suffix list.
+	SameSite bool
+
+	// Stop redirects that leave the allowed domain (or site, with SameSite)
+	// with ErrOffDomainRedirect, recording the page as a dead link, so a
+	// redirect can't take the crawl outside its scope. Off by default, as
+	// sites commonly redirect to another scheme or to and from "www."
+	BlockOffDomainRedirects bool
+
+	// Follow <meta name="robots"> directives: don't follow links from nofollow
+	// pages and set NoIndex on noindex pages, which are still kept in the tree
+	RespectMetaRobots bool
+
+	// Queue at most this many new links from each page, unlimited when zero.
+	// Every link is still recorded in Page.Links.
+	MaxFollowPerPage int
+
+	// Crawl pages on at most this many hosts, counting the seed's, unlimited
+	// when zero. Once the limit's reached, links to new hosts aren't
+	// followed while hosts already crawled carry on as normal. Only matters
+	// when the crawl can leave the seed's host, e.g. with SameSite.
+	MaxHosts int
+
+	// Follow at most this many links to each path that differ only in their
+	// query string, e.g. /calendar?date=2024-01-01, /calendar?date=2024-01-02
+	// and so on, so generated links can't trap the crawl. The path without a
+	// query doesn't count. Unlimited when zero.
+	MaxQueryVariants int
+
+	// Treat URLs that only differ in their query string as the same page, so
+	// each path is fetched once with whichever query it was first found
+	// with. The other variants found are recorded in CrawlResult.CollapsedQueries.
+	DedupByPathOnly bool
+
+	// Skip links longer than this, such as URLs with encoded session state,
+	// unlimited when zero. They stay in Page.Links but are never fetched or
+	// added to the visited set.
+	MaxURLLength int
+
+	// Don't build the page tree, instead releasing each page once it's been
+	// handed on, so memory use doesn't grow with the size of the site. Only
+	// useful with streaming output like CrawlSitemapTo: a Run result's root
+	// has no children. CrawlFlatTo always releases pages.
+	ReleasePages bool
+
+	// Group pages with the same ContentHash into CrawlResult.Duplicates
+	DetectDuplicates bool
+
+	// Gather every asset into CrawlResult.Assets as pages are crawled, each
+	// listed once with the pages using it, so shared assets like a site-wide
+	// stylesheet can be reported once. Pages that write an asset the same
+	// way share one copy of the string. Unlike building the list from the
+	// tree afterwards, this also works with ReleasePages.
+	DedupAssets bool
+
+	// Only nest pages this many levels below the root in Crawl's JSON, deeper
+	// pages are written as a PageRef. Doesn't limit the crawl itself, see
+	// CrawlResult.JSONDepth. Unlimited when zero.
+	MaxJSONDepth int
+
+	// Stop the crawl once Crawl's JSON output is estimated to reach this
+	// many bytes, returning the pages gathered so far. Pages that arrive
+	// after that and would take the output over the limit are left out,
+	// apart from the seed page. Unlimited when zero.
+	MaxOutputBytes int64
+
+	// Write page and asset URLs under RootUrl relative to it, e.g.
+	// "/about.html", in Crawl, CrawlFlat, CrawlFlatTo and CrawlAssets output,
+	// so the site map isn't tied to one host. See CrawlResult.Relative.
+	RelativeUrls bool
+
+	// Record each page's links in Page.ScopedLinks, flagged as internal or
+	// external the same way the crawl decides what it may fetch
+	RecordLinkScope bool
+
+	// Record what was decided for each URL found, fetched or skipped and
+	// why, in CrawlResult.Trace. For finding out why a page was or wasn't crawled.
+	Trace bool
+
+	// Record how each page's URL was found in Page.Source, such as from an
+	// <a>, a canonical link or an HTTP Link header. A page reached
+	// more than one way keeps the way it was first found, and a page
+	// reached through a redirect is recorded as SourceRedirect.
+	RecordSources bool
+
+	// Where to write each failed fetch as it happens, as a line of JSON
+	// (see ErrorLogEntry). Fetches that will be retried are included. It's
+	// written to from several goroutines, but never concurrently.
+	ErrorLog io.Writer
+
+	// Give up on the crawl when no page has finished, fetched or failed, for
+	// this long after the seed, e.g. because every fetch is stuck on a slow
+	// host. In-flight fetches are cancelled and the partial result is returned
+	// along with ErrIdleTimeout. Waiting out RetryDelay, Jitter or a
+	// HostCooldown counts as idle. No limit when zero.
+	IdleTimeout time.Duration
+
+	// Used to time delays, retries, cooldowns, the ramp up and
+	// UrlParser.ParseTimeout, and to set CrawlResult.CrawledAt. The system
+	// clock when nil.
+	Clock Clock
+
+	// Keep up to CacheSize parsed pages in memory during the crawl, so
+	// pages crawled again, such as with a Visited store that forgets URLs,
+	// aren't fetched and parsed again. Set PageCache instead to keep the
+	// pages between crawls.
+	CacheSize int
+	PageCache *PageCache
+
+	// URL prefix every fetch has to start with, set from the seed by ConfineToSeedPath
+	scope string
+
+	// The page cache used by the crawl, from PageCache or CacheSize
+	cache *PageCache
+}
+
+// A ScopedLink is a link along with whether the crawl considered it internal,
+// i.e. on the allowed domain or site and under the seed's directory when
+// ConfineToSeedPath is set
+type ScopedLink struct {
+	Url      string
+	Internal bool
 }
 
 type PageMessage struct {
 	Page  *Page
 	Error error
 	Url   string
+	link  queuedLink
+
+	// Whether the page was taken from the page cache without a request
+	cached bool
+
+	// Result of the HEAD request for an asset link
+	assetStatus int
+	assetType   string
 }
 
-// Starts crawling from a given URL or path.
-func (w WebCrawler) Crawl(url string) ([]byte, error) {
-	c := make(chan *PageMessage)
+// A CrawlResult is the page tree from a crawl along with what was
+// learned about the site on the way
+type CrawlResult struct {
+	Root *Page
 
-	// Make a slice of errors to append errors to
-	// TODO: Make use of these or get rid of them
-	var errors []error
+	// Number of links seen to each host, internal and external
+	Hosts map[string]int
 
-	url = getAbsoluteUrl(w.RootUrl, url)
-	page, err := w.fetchPage(url)
+	// URLs that couldn't be fetched, mapped to why. Each is only tried once,
+	// plus any retries. Links skipped for being off the allowed domain or not
+	// http(s) aren't dead, so aren't included.
+	DeadLinks map[string]string
 
+	// Status code from a HEAD request for each asset when ValidateAssets is set,
+	// zero if the request failed
+	AssetStatus map[string]int `json:",omitempty"`
+
+	// Type of each asset when ValidateAssets is set, from the Content-Type of
+	// its HEAD response, or from its extension when that doesn't say
+	AssetTypes map[string]string `json:",omitempty"`
+
+	// When the crawl started
+	CrawledAt time.Time
+
+	// Sorted URLs of pages serving identical content, by content hash, when
+	// DetectDuplicates is set. Only hashes shared by more than one page are included.
+	Duplicates map[string][]string `json:",omitempty"`
+
+	// Every unique asset and the pages using it when DedupAssets is set, see AssetsJSON
+	Assets []AssetRef `json:",omitempty"`
+
+	// Links that weren't followed because of DedupByPathOnly, sorted and
+	// keyed by the URL that was followed for their path instead
+	CollapsedQueries map[string][]string `json:",omitempty"`
+
+	// What was decided for each URL when Trace is set, in the order the
+	// decisions were made. A URL skipped on one page may appear again when
+	// it's found on another, but links already seen aren't recorded again.
+	Trace []TraceEntry `json:",omitempty"`
+
+	// Requests made for pages, asset checks and stylesheets, including the
+	// seed and every retry but not links skipped without a request or cache
+	// hits, see MaxAttempts
+	Attempts int
+}
+
+// Starts crawling from a given URL or path.
+func (w WebCrawler) Crawl(url string) ([]byte, error) {
+	result, err := w.Run(url)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %v", err, url)
+		return nil, err
 	}
 
-	// Mark root url as requested and set the root page
-	requestedUrls := make(map[string]bool)
-	requestedUrls[url] = true
-	rootPage := page
-
-	go func() {
-		c <- &PageMessage{Page: page, Url: url}
-	}()
+	return w.output(result).JSONDepth(w.MaxJSONDepth)
+}
 
-	for waiting := 1; waiting > 0; waiting-- {
-		pageMsg := <-c
+// Crawls from a given URL or path and returns everything gathered.
+func (w WebCrawler) Run(url string) (*CrawlResult, error) {
+	return w.RunContext(context.Background(), url)
+}
 
-		if pageMsg.Error != nil {
-			errors = append(errors, fmt.Errorf("%v: %v", pageMsg.Error, pageMsg.Url))
-			continue
-		}
+// Like Run, but stops fetching when ctx is done. In-flight requests are
+// cancelled and the partial result is returned along with ctx's error.
+func (w WebCrawler) RunContext(ctx context.Context, url string) (*CrawlResult, error) {
+	return w.crawl(ctx, url, nil)
+}
 
-		page := pageMsg.Page
+// Like Run, but gives up after d. On timeout the partial result is returned
+// along with ErrCrawlTimeout, or just the error if the seed page wasn't fetched in time.
+func (w WebCrawler) CrawlWithTimeout(url string, d time.Duration) (*CrawlResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
 
-		if page.parent != nil {
-			page.parent.Children[page.Url] = page
+	result, err := w.RunContext(ctx, url)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && errors.Is(err, context.DeadlineExceeded) {
+		if result != nil {
+			return result, ErrCrawlTimeout
 		}
+		return nil, fmt.Errorf("%w: %v", ErrCrawlTimeout, err)
+	}
+	return result, err
+}
 
-		// We've hit the fetch limit, don't fetch any more but finish processing the ones in flight
-		if w.FetchLimit != 0 && len(requestedUrls) >= w.FetchLimit {
-			continue
-		}
+// Crawls from a given URL or path. When onPage isn't nil it's called with
+// each page as it's added to the tree, always from the crawl's main loop so
+// calls never overlap.
+func (w WebCrawler) crawl(ctx context.Context, url string, onPage func(*Page)) (*CrawlResult, error) {
+	c := make(chan *PageMessage)
+	clock := w.clock()
+	result := &CrawlResult{
+		Hosts:     make(map[string]int),
+		DeadLinks: make(map[string]string),
+		CrawledAt: clock.Now(),
+	}
 
-		// Fetch pages in goroutines without repeating any
-		for _, l := range page.Links {
-			l = getAbsoluteUrl(w.RootUrl, l)
-			if requestedUrls[l] != true {
-				// Mark as requested, and let the loop know to wait for one more
-				requestedUrls[l] = true
+	w.Parser = w.crawlParser()
 
-				waiting++
-				go func(link string) {
-					result, err := w.fetchPage(link)
-					if result != nil {
-						result.parent = page
-					}
-					c <- &PageMessage{Page: result, Error: err, Url: link}
-				}(l)
-			}
+	w.cache = w.PageCache
+	if w.cache == nil && w.CacheSize > 0 {
+		w.cache = NewPageCache(w.CacheSize)
+	}
+
+	rng := newLockedRand(w.RandSeed)
+	if w.RandSeed != 0 || w.RecordSources || w.Clock != nil || w.Parser.ParseCSSAssets {
+		parser := *w.Parser
+		if w.RandSeed != 0 {
+			parser.rand = rng
+		}
+		parser.recordSources = w.RecordSources
+		parser.clock = w.Clock
+		if parser.ParseCSSAssets {
+			parser.cssScope = w.checkAssetUrl
 		}
+		w.Parser = &parser
 	}
 
-	b, jErr := json.MarshalIndent(rootPage, "", "  ")
-	if jErr != nil {
-		return nil, fmt.Errorf("Error generating JSON Site Map: %s", jErr)
+	if w.Prepare != nil {
+		if err := w.Prepare(w.Parser.Client); err != nil {
+			return nil, fmt.Errorf("Error preparing crawl: %v", err)
+		}
 	}
 
-	return b, nil
-}
+	url = getAbsoluteUrl(w.RootUrl, url)
+	if w.ConfineToSeedPath {
+		w.scope = seedDir(url)
+	}
 
-func getAbsoluteUrl(rootUrl string, url string) string {
-	if strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//") {
-		return fmt.Sprint(rootUrl, url)
+	errLog := newErrorLog(w.ErrorLog)
+	var err error
+	page, seedCached := w.cachedSeed(url)
+	if !seedCached {
+		page, err = w.fetchSeed(ctx, url)
+		errLog.record(url, err, clock.Now())
 	}
-	return url
-}
 
-// Fetches a page from an absolute URL
-func (w WebCrawler) fetchPage(url string) (*Page, error) {
-	if !strings.HasPrefix(url, w.RootUrl) {
-		return nil, fmt.Errorf("%s", "Url invalid or outside of allowed domain")
+	seedAttempts := 1
+	for ; err != nil && seedAttempts <= w.MaxRetries && w.retryable(err) && (w.MaxAttempts == 0 || seedAttempts < w.MaxAttempts); seedAttempts++ {
+		if err = sleep(ctx, clock, w.RetryDelay); err == nil {
+			page, err = w.fetchSeed(ctx, url)
+			errLog.record(url, err, clock.Now())
+		}
 	}
 
-	links, assets, err := w.Parser.Parse(url)
 	if err != nil {
-		return nil, err
+		if !w.ContinueOnRootError {
+			return nil, fmt.Errorf("%w: %v", err, url)
+		}
+		page = &Page{Url: url, Error: err.Error(), Children: make(map[string]*Page)}
+		result.DeadLinks[url] = err.Error()
 	}
 
-	page := Page{
-		Url:      url,
-		Assets:   assets,
-		Links:    links,
-		Children: make(map[string]*Page),
+	// Body bytes downloaded so far, updated by the fetching goroutines
+	var downloaded int64
+	if !seedCached {
+		downloaded = page.Size + page.cssBytes
 	}
 
-	return &page, nil
-}
+	// Estimated size of the JSON output so far, and whether a page has been
+	// left out of it for MaxOutputBytes
+	var outputBytes int64
+	outputFull := false
 
-// Gets slices of links and assets from a goquery.Document
-func GetAttributesFromDocument(doc *goquery.Document) (links []string, assets []string) {
-	// Links without "#" or empty links
-	links = doc.Find("a[href]").Not("a[href='#']").Not("a[href='']").
-		Map(func(_ int, s *goquery.Selection) string {
-		href, _ := s.Attr("href")
-		return href
-	})
+	// Mark root url as requested, the root page is set once it's been processed
+	visited := w.Visited
+	if visited == nil {
+		visited = &MemoryVisited{}
+	}
+	for _, u := range w.PreVisited {
+		visited.MarkSeen(w.visitKey(getAbsoluteUrl(w.RootUrl, u)))
+	}
+	visited.MarkSeen(w.visitKey(url))
+	var rootPage *Page
 
-	// CSS and other "link" elements
-	assets = doc.Find("link[href]").Map(func(i int, s *goquery.Selection) string {
-		href, _ := s.Attr("href")
-		return href
-	})
+	// The URL fetched for each path and the other variants of it found, for DedupByPathOnly
+	pathUrls := map[string]string{w.visitKey(url): url}
+	collapsed := make(map[string]map[string]bool)
 
-	//Anything with the "src" attribute (media or scripts)
-	assets = append(
-		assets,
-		doc.Find("[src]").Map(func(i int, s *goquery.Selection) string {
-			src, _ := s.Attr("src")
-			return src
-		})...)
+	assets := newAssetValidator(w.VerifiedAssets)
+	collected := newAssetCollector()
+	byHash := make(map[string][]string)
 
-	return links, assets
-}
+	// Links waiting for a fetch, in the order they were found
+	var queue []queuedLink
 
-// Grabs links and assets from a page at a URL
-func (u UrlParser) Parse(url string) (links []string, assets []string, err error) {
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, nil, err
+	// Fetches started (including the root) and still in flight that count
+	// towards the limits, and pages fetched successfully
+	launched, inFlight, fetched := seedAttempts, 0, 0
+	if !w.RetriesCountTowardsLimits {
+		launched = 1
 	}
-	if res.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("Got a %d status code when getting URL [%s]", res.StatusCode, url)
+	if !seedCached {
+		result.Attempts = seedAttempts
 	}
 
-	doc, err := goquery.NewDocumentFromResponse(res)
-	if err != nil {
-		return nil, nil, err
+	// Pages fetched at each depth, for MaxPerDepth
+	perDepth := map[int]int{0: 1}
+
+	// Hosts with pages queued or crawled, for MaxHosts
+	crawlHosts := map[string]bool{hostOf(url): true}
+
+	// Links with a query queued for each path, for MaxQueryVariants
+	queryVariants := make(map[string]int)
+
+	// Fetches running now, for MaxConcurrency
+	running := 0
+	start := clock.Now()
+
+	// Failed fetches in a row for each host, and when paused hosts can be fetched again
+	hostFailures := make(map[string]int)
+	pausedUntil := make(map[string]time.Time)
+
+	// When the next request to each host can start, for CrawlDelay
+	nextRequest := map[string]time.Time{hostOf(url): start.Add(w.CrawlDelay)}
+
+	// Records a decision about a URL for Trace
+	trace := func(u string, decision string, reason string) {
+		if w.Trace {
+			result.Trace = append(result.Trace, TraceEntry{Url: u, Decision: decision, Reason: reason})
+		}
+	}
+
+	// Why fetching stopped with links still queued, for Trace
+	stopReason := ""
+
+	// Records a link that couldn't be fetched and won't be tried again.
+	// Failed URLs stay marked as requested so they aren't tried again.
+	// Links skipped for being out of scope aren't dead, so are only traced.
+	fail := func(link queuedLink, err error) {
+		decision := traceDecision(err)
+		trace(link.url, decision, err.Error())
+		if decision != TraceFailed {
+			return
+		}
+		result.DeadLinks[link.url] = err.Error()
+
+		if w.IncludeFailedPages {
+			stub := &Page{Url: link.url, Error: err.Error(), Children: make(map[string]*Page), Source: link.source}
+			if !w.ReleasePages {
+				link.parent.Children[stub.Url] = stub
+			}
+			if onPage != nil {
+				onPage(stub)
+			}
+		}
 	}
 
-	links, assets = GetAttributesFromDocument(doc)
-	return links, assets, nil
+	// Lets IdleTimeout cancel the fetches in flight
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	idled := false
+
+	go func() {
+		c <- &PageMessage{Page: page, Url: url, cached: seedCached}
+	}()
+
+	// A single wait for IdleTimeout is kept pending, and when it fires early
+	// because a page finished in the meantime, it's started again for
+	// whatever is left since then
+	var idle <-chan time.Time
+	lastFinished := clock.Now()
+
+	for waiting := 1; waiting > 0; waiting-- {
+		var pageMsg *PageMessage
+		for pageMsg == nil {
+			if w.IdleTimeout > 0 && !idled && idle == nil {
+				idle = clock.After(lastFinished.Add(w.IdleTimeout).Sub(clock.Now()))
+			}
+
+			select {
+			case pageMsg = <-c:
+			case <-idle:
+				idle = nil
+				if clock.Now().Sub(lastFinished) >= w.IdleTimeout {
+					// Cancelled fetches finish straight away
+					idled = true
+					cancel()
+					pageMsg = <-c
+				}
+			}
+		}
+		lastFinished = clock.Now()
+		if pageMsg.link.counted {
+			inFlight--
+		}
+		if pageMsg.Page != nil && !pageMsg.cached {
+			// Stylesheets fetched for the page's assets count like fetches
+			result.Attempts += pageMsg.Page.cssRequests
+			launched += pageMsg.Page.cssRequests
+		}
+		if pageMsg.link.url != "" {
+			running--
+		}
+
+		if w.HostErrorThreshold > 0 && !pageMsg.link.asset {
+			host := hostOf(pageMsg.Url)
+			if pageMsg.Error == nil {
+				delete(hostFailures, host)
+			} else if w.retryable(pageMsg.Error) {
+				if hostFailures[host]++; hostFailures[host] >= w.HostErrorThreshold {
+					pausedUntil[host] = clock.Now().Add(w.HostCooldown)
+					delete(hostFailures, host)
+				}
+			}
+		}
+
+		if pageMsg.link.asset {
+			assets.record(pageMsg.Url, pageMsg.assetStatus, pageMsg.assetType)
+		} else if pageMsg.Error != nil {
+			link := pageMsg.link
+			if link.attempt < w.MaxRetries && w.retryable(pageMsg.Error) {
+				// Try again before anything else
+				link.attempt++
+				link.lastErr = pageMsg.Error
+				queue = append([]queuedLink{link}, queue...)
+			} else {
+				fail(link, pageMsg.Error)
+			}
+		} else if page := w.addPage(pageMsg.Page, &rootPage); page == nil {
+			trace(pageMsg.Url, TraceSkippedFilter, "Dropped by PageHook")
+		} else {
+			page.Seq = fetched
+			if w.RecordSources {
+				page.Source = pageMsg.link.source
+				if page == rootPage {
+					page.Source = SourceSeed
+				} else if len(page.RedirectChain) > 0 {
+					page.Source = SourceRedirect
+				}
+			}
+
+			// Only needed for queueing its links
+			sources := page.linkSources
+			page.linkSources = nil
+
+			if w.RecordLinkScope {
+				page.ScopedLinks = w.scopedLinks(page)
+			}
+
+			nofollow := false
+			if w.RespectMetaRobots {
+				page.NoIndex = hasRobotsDirective(page, "noindex")
+				nofollow = hasRobotsDirective(page, "nofollow")
+			}
+
+			size := int64(0)
+			if w.MaxOutputBytes > 0 {
+				size = outputSize(page, pageMsg.link.depth)
+			}
+
+			if w.MaxOutputBytes > 0 && outputBytes+size > w.MaxOutputBytes && page != rootPage {
+				// Still go on to launch whatever is queued, like retries that
+				// aren't counted towards the limits
+				if !w.ReleasePages {
+					delete(page.parent.Children, page.Url)
+				}
+				trace(page.Url, TraceSkippedLimit, "MaxOutputBytes reached")
+				stopReason = "MaxOutputBytes reached"
+				outputFull = true
+			} else {
+				outputBytes += size
+
+				if page.Error != "" {
+					trace(page.Url, TraceFailed, page.Error)
+				} else {
+					detail := ""
+					if pageMsg.cached {
+						detail = "Taken from PageCache"
+					}
+					trace(page.Url, TraceFetched, detail)
+				}
+				fetched++
+
+				if w.DedupAssets {
+					collected.intern(page)
+				}
+
+				// The page is complete apart from its children from here on
+				if onPage != nil {
+					onPage(page)
+				}
+
+				countHosts(result.Hosts, page)
+
+				if w.DetectDuplicates {
+					byHash[page.ContentHash] = append(byHash[page.ContentHash], page.Url)
+				}
+
+				if w.DedupAssets {
+					collected.add(page)
+				}
+
+				links := page.Links
+				if nofollow {
+					for _, l := range links {
+						trace(w.linkUrl(page, l), TraceSkippedRobots, "Found on a nofollow page")
+					}
+					links = nil
+				}
+
+				// Queue up pages to fetch without repeating any
+				depth := pageMsg.link.depth + 1
+				followed := 0
+				for _, l := range links {
+					source := linkSource(sources, l)
+					if w.MaxFollowPerPage > 0 && followed >= w.MaxFollowPerPage {
+						if !w.Trace {
+							break
+						}
+						trace(w.linkUrl(page, l), TraceSkippedLimit, "MaxFollowPerPage reached")
+						continue
+					}
+
+					l = w.linkUrl(page, l)
+					if w.MaxURLLength > 0 && len(l) > w.MaxURLLength {
+						trace(l, TraceSkippedFilter, "Longer than MaxURLLength")
+						continue
+					}
+					if w.ShouldFetch != nil && !w.ShouldFetch(l, depth, page) {
+						trace(l, TraceSkippedFilter, "Rejected by ShouldFetch")
+						continue
+					}
+					// Only recorded once the link is queued below
+					newHost := ""
+					if w.MaxHosts > 0 && w.checkUrl(l) == nil {
+						if host := hostOf(l); !crawlHosts[host] {
+							if len(crawlHosts) >= w.MaxHosts {
+								trace(l, TraceSkippedLimit, "MaxHosts reached")
+								continue
+							}
+							newHost = host
+						}
+					}
+					path, hasQuery := queryPath(l)
+					if hasQuery && w.MaxQueryVariants > 0 && queryVariants[path] >= w.MaxQueryVariants {
+						trace(l, TraceSkippedLimit, "MaxQueryVariants reached")
+						continue
+					}
+					key := w.visitKey(l)
+					if !visited.MarkSeen(key) {
+						if first, ok := pathUrls[key]; w.DedupByPathOnly && ok && first != l {
+							if collapsed[first] == nil {
+								collapsed[first] = make(map[string]bool)
+							}
+							collapsed[first][l] = true
+						}
+						continue
+					}
+					if w.DedupByPathOnly {
+						pathUrls[key] = l
+					}
+					if hasQuery {
+						queryVariants[path]++
+					}
+					if newHost != "" {
+						crawlHosts[newHost] = true
+					}
+
+					followed++
+					link := queuedLink{url: l, parent: page, depth: depth, source: source}
+					if w.MaxPerDepth > 0 {
+						queue = insertByDepth(queue, link)
+					} else {
+						queue = append(queue, link)
+					}
+				}
+
+				// Assets are checked alongside the page's links
+				if w.ValidateAssets {
+					for _, a := range assets.unchecked(w, page) {
+						link := queuedLink{url: a, depth: depth, asset: true}
+						if w.MaxPerDepth > 0 {
+							queue = insertByDepth(queue, link)
+						} else {
+							queue = append(queue, link)
+						}
+					}
+				}
+
+				if w.ReleasePages && page != rootPage {
+					// Links queued from the page still point at it, so clear out the rest
+					*page = Page{Url: page.Url}
+				}
+			}
+		}
+
+		// Fetch queued pages in goroutines until we hit a limit or are cancelled,
+		// then just finish processing the ones in flight
+		for len(queue) > 0 && ctx.Err() == nil {
+			if w.MaxConcurrency > 0 && running >= w.concurrencyLimit(clock.Now().Sub(start)) {
+				break
+			}
+
+			next := queue[0]
+			next.counted = !next.asset && (next.attempt == 0 || w.RetriesCountTowardsLimits)
+
+			// Drop links on levels that are already full
+			if w.MaxPerDepth > 0 && !next.asset && next.attempt == 0 && perDepth[next.depth] >= w.MaxPerDepth {
+				trace(next.url, TraceSkippedLimit, "MaxPerDepth reached")
+				queue = queue[1:]
+				continue
+			}
+
+			// Links out of scope are skipped without starting a fetch. Assets
+			// were checked before they were queued.
+			if err := w.checkUrl(next.url); err != nil && !next.asset {
+				trace(next.url, traceDecision(err), err.Error())
+				queue = queue[1:]
+				continue
+			}
+
+			// Cached pages are taken from the cache without a request
+			var cached *Page
+			if !next.asset {
+				cached, _ = w.cache.get(next.url)
+			}
+			attempt := cached == nil
+			if attempt && w.MaxAttempts > 0 && result.Attempts >= w.MaxAttempts {
+				stopReason = "MaxAttempts reached"
+				break
+			}
+
+			if next.counted {
+				if w.FetchLimit != 0 {
+					used := launched
+					if w.FetchLimitCountsSuccesses {
+						used = fetched + inFlight
+					}
+					if used >= w.FetchLimit {
+						stopReason = "FetchLimit reached"
+						break
+					}
+				}
+
+				if w.MaxTotalBytes != 0 && atomic.LoadInt64(&downloaded) >= w.MaxTotalBytes {
+					stopReason = "MaxTotalBytes reached"
+					break
+				}
+
+				if w.MaxOutputBytes != 0 && (outputFull || outputBytes >= w.MaxOutputBytes) {
+					stopReason = "MaxOutputBytes reached"
+					break
+				}
+
+				launched++
+				inFlight++
+			} else if next.asset && w.MaxTotalBytes != 0 && atomic.LoadInt64(&downloaded) >= w.MaxTotalBytes {
+				stopReason = "MaxTotalBytes reached"
+				break
+			}
+
+			if attempt {
+				result.Attempts++
+			}
+			queue = queue[1:]
+			if next.attempt == 0 && !next.asset {
+				perDepth[next.depth]++
+			}
+
+			var delay time.Duration
+			if next.attempt > 0 {
+				delay = w.RetryDelay
+			}
+			if w.Jitter > 0 {
+				delay += time.Duration(rng.Int63n(int64(w.Jitter)))
+			}
+			if until, ok := pausedUntil[hostOf(next.url)]; ok {
+				if wait := until.Sub(clock.Now()); wait > 0 {
+					delay += wait
+				}
+			}
+			if w.CrawlDelay > 0 && attempt {
+				host := hostOf(next.url)
+				now := clock.Now()
+				if wait := nextRequest[host].Sub(now.Add(delay)); wait > 0 {
+					delay += wait
+				}
+				nextRequest[host] = now.Add(delay + w.CrawlDelay)
+			}
+
+			// Let the loop know to wait for one more
+			waiting++
+			running++
+			go func(link queuedLink, cached *Page) {
+				if cached != nil {
+					cached.parent = link.parent
+					c <- &PageMessage{Page: cached, Url: link.url, link: link, cached: true}
+					return
+				}
+
+				if link.asset {
+					status, assetType := 0, ClassifyAsset(link.url)
+					if sleep(ctx, clock, delay) == nil {
+						status, assetType = headAsset(ctx, w.Parser, link.url)
+					}
+					c <- &PageMessage{Url: link.url, link: link, assetStatus: status, assetType: assetType}
+					return
+				}
+
+				var page *Page
+				err := sleep(ctx, clock, delay)
+				if err == nil {
+					page, err = w.fetchPage(ctx, link.url)
+				}
+				errLog.record(link.url, err, clock.Now())
+				if page != nil {
+					page.parent = link.parent
+					atomic.AddInt64(&downloaded, page.Size+page.cssBytes)
+				}
+				c <- &PageMessage{Page: page, Error: err, Url: link.url, link: link}
+			}(next, cached)
+		}
+	}
+
+	// Retries that never got to run leave their links failed, anything else
+	// still queued was stopped by a limit or cancellation
+	if idled {
+		stopReason = "IdleTimeout reached"
+	} else if ctx.Err() != nil {
+		stopReason = ctx.Err().Error()
+	}
+	for _, link := range queue {
+		if link.attempt > 0 {
+			fail(link, link.lastErr)
+		} else if !link.asset {
+			trace(link.url, TraceSkippedLimit, stopReason)
+		}
+	}
+
+	if rootPage == nil {
+		return nil, fmt.Errorf("Root page was dropped by PageHook: %v", url)
+	}
+
+	if w.ValidateAssets {
+		result.AssetStatus, result.AssetTypes = assets.status, assets.types
+	}
+
+	if w.DetectDuplicates {
+		result.Duplicates = duplicateGroups(byHash)
+	}
+
+	if w.DedupAssets {
+		result.Assets = collected.refs()
+	}
+
+	for first, variants := range collapsed {
+		if result.CollapsedQueries == nil {
+			result.CollapsedQueries = make(map[string][]string)
+		}
+		for v := range variants {
+			result.CollapsedQueries[first] = append(result.CollapsedQueries[first], v)
+		}
+		sort.Strings(result.CollapsedQueries[first])
+	}
+
+	result.Root = rootPage
+	if idled {
+		return result, ErrIdleTimeout
+	}
+	return result, ctx.Err()
+}
+
+// Keeps the groups of URLs that share a hash, sorted
+func duplicateGroups(byHash map[string][]string) map[string][]string {
+	groups := make(map[string][]string)
+	for hash, urls := range byHash {
+		if len(urls) > 1 {
+			sort.Strings(urls)
+			groups[hash] = urls
+		}
+	}
+	return groups
+}
+
+// Gets how many fetches can run at once this far into the crawl, ramping
+// up from 1 to MaxConcurrency over RampUp
+func (w WebCrawler) concurrencyLimit(elapsed time.Duration) int {
+	if w.RampUp <= 0 || elapsed >= w.RampUp {
+		return w.MaxConcurrency
+	}
+	return 1 + int(int64(w.MaxConcurrency-1)*int64(elapsed)/int64(w.RampUp))
+}
+
+// Default file names treated as a directory's index page
+var defaultIndexFiles = []string{"index.html", "index.htm", "default.html"}
+
+// Gets the key a URL is tracked under to avoid fetching the same page twice
+func (w WebCrawler) visitKey(u string) string {
+	if w.DedupByPathOnly {
+		u, _ = queryPath(u)
+	}
+	if w.CollapseIndexPages {
+		indexFiles := w.IndexFiles
+		if len(indexFiles) == 0 {
+			indexFiles = defaultIndexFiles
+		}
+		u = collapseIndex(u, indexFiles)
+	}
+	return u
+}
+
+// Strips an index file name from the end of a URL's path
+func collapseIndex(u string, indexFiles []string) string {
+	rest := ""
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u, rest = u[:i], u[i:]
+	}
+
+	for _, name := range indexFiles {
+		if strings.HasSuffix(u, "/"+name) {
+			return strings.TrimSuffix(u, name) + rest
+		}
+	}
+	return u + rest
+}
+
+// Gets the clock the crawl runs on
+func (w WebCrawler) clock() Clock {
+	if w.Clock != nil {
+		return w.Clock
+	}
+	return realClock{}
+}
+
+// Waits for d on clock, returning early with ctx's error if it's done first
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// A link waiting to be fetched, along with the page it was found on
+type queuedLink struct {
+	url    string
+	parent *Page
+	depth  int
+
+	// How the link was found, for RecordSources
+	source string
+
+	// Retries made so far, whether this attempt counts towards the limits,
+	// and why the last attempt failed
+	attempt int
+	counted bool
+	lastErr error
+
+	// Whether the link is an asset to check with a HEAD request for ValidateAssets
+	asset bool
+}
+
+// Adds a link to the queue after every link at the same depth or shallower
+func insertByDepth(queue []queuedLink, link queuedLink) []queuedLink {
+	i := len(queue)
+	for i > 0 && queue[i-1].depth > link.depth {
+		i--
+	}
+
+	queue = append(queue, queuedLink{})
+	copy(queue[i+1:], queue[i:])
+	queue[i] = link
+	return queue
+}
+
+// Checks whether a failed fetch should be tried again, using RetryableFunc if set
+func (w WebCrawler) retryable(err error) bool {
+	if w.RetryableFunc == nil {
+		return isRetryable(err)
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	statusCode := 0
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		statusCode = statusErr.Code
+	}
+	return w.RetryableFunc(statusCode, err)
+}
+
+// Checks whether a failed fetch is worth trying again: network errors,
+// server errors and 429 Too Many Requests
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, ErrShortBody) {
+		return true
+	}
+
+	// Asking again won't get a newer protocol or a different redirect
+	if errors.Is(err, ErrTLSVersion) || errors.Is(err, ErrOffDomainRedirect) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500 || statusErr.Code == http.StatusTooManyRequests
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// Runs the PageHook on a fetched page and adds it to the tree, setting root
+// if it has no parent. Returns the page as stored, or nil if it was dropped.
+func (w WebCrawler) addPage(page *Page, root **Page) *Page {
+	parent := page.parent
+
+	if w.PageHook != nil {
+		if page = w.PageHook(page); page == nil {
+			return nil
+		}
+		page.parent = parent
+	}
+
+	if parent == nil {
+		*root = page
+	} else if !w.ReleasePages {
+		parent.Children[page.Url] = page
+	}
+
+	return page
+}
+
+// Checks whether a page's meta robots include a directive, or "none" which
+// means both noindex and nofollow
+func hasRobotsDirective(page *Page, directive string) bool {
+	for _, d := range page.Robots {
+		if d == directive || d == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds a page's links to the per host link counts
+func countHosts(hosts map[string]int, page *Page) {
+	for _, l := range page.Links {
+		u, err := url.Parse(resolveUrl(page.Url, l))
+		if err != nil || u.Host == "" {
+			continue
+		}
+		hosts[strings.ToLower(u.Host)]++
+	}
+}
+
+// Gets the lowercased host of a URL, empty if it can't be parsed
+func hostOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+func getAbsoluteUrl(rootUrl string, url string) string {
+	if strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//") {
+		return fmt.Sprint(rootUrl, url)
+	}
+	return url
+}
+
+// Gets the absolute URL of a link found on a page
+func (w WebCrawler) linkUrl(page *Page, link string) string {
+	if w.SameSite {
+		// Pages can be on other hosts, so resolve against the page itself
+		return resolveUrl(page.Url, link)
+	}
+	return getAbsoluteUrl(w.RootUrl, link)
+}
+
+// Gets a page's links with whether each is in the crawl's scope
+func (w WebCrawler) scopedLinks(page *Page) []ScopedLink {
+	if len(page.Links) == 0 {
+		return nil
+	}
+
+	scoped := make([]ScopedLink, len(page.Links))
+	for i, l := range page.Links {
+		l = w.linkUrl(page, l)
+		scoped[i] = ScopedLink{Url: l, Internal: w.checkUrl(l) == nil}
+	}
+	return scoped
+}
+
+// Fetches a page from an absolute URL
+func (w WebCrawler) fetchPage(ctx context.Context, url string) (*Page, error) {
+	if err := w.checkUrl(url); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := w.checkBody(w.Parser.ParseRequest(req))
+	if err == nil {
+		w.cache.add(url, page)
+	}
+	return page, err
+}
+
+// Turns a fetched page with a body shorter than MinBodyBytes into an error
+func (w WebCrawler) checkBody(page *Page, err error) (*Page, error) {
+	if err == nil && page.Size < w.MinBodyBytes {
+		return nil, fmt.Errorf("%w, got %d bytes", ErrShortBody, page.Size)
+	}
+	return page, err
+}
+
+// Gets a copy of the seed page from the page cache, if it's in scope and
+// fetched with a plain GET
+func (w WebCrawler) cachedSeed(url string) (*Page, bool) {
+	if w.SeedMethod != "" || w.SeedBody != nil || w.checkUrl(url) != nil {
+		return nil, false
+	}
+	return w.cache.get(url)
+}
+
+// Fetches the seed page, using the configured seed method and body if any
+func (w WebCrawler) fetchSeed(ctx context.Context, url string) (*Page, error) {
+	if w.SeedMethod == "" && w.SeedBody == nil {
+		return w.fetchPage(ctx, url)
+	}
+
+	if err := w.checkUrl(url); err != nil {
+		return nil, err
+	}
+
+	method := w.SeedMethod
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(w.SeedBody))
+	if err != nil {
+		return nil, err
+	}
+
+	if w.SeedBody != nil {
+		contentType := w.SeedContentType
+		if contentType == "" {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return w.checkBody(w.Parser.ParseRequest(req))
+}
+
+// Checks that a URL is one the crawler is allowed to fetch
+func (w WebCrawler) checkUrl(url string) error {
+	if !hasAllowedScheme(url) {
+		return ErrUnsupportedScheme
+	}
+
+	if err := w.checkDomain(url); err != nil {
+		return err
+	}
+
+	if w.scope != "" && !strings.HasPrefix(url, w.scope) {
+		return scopeError("Url outside of the seed's directory")
+	}
+
+	return nil
+}
+
+// Checks whether a URL is on the allowed domain, or site with SameSite
+func (w WebCrawler) checkDomain(url string) error {
+	if w.SameSite {
+		if !sameSite(url, w.RootUrl) {
+			return scopeError("Url invalid or outside of allowed site")
+		}
+	} else if !strings.HasPrefix(url, w.RootUrl) {
+		return scopeError("Url invalid or outside of allowed domain")
+	}
+	return nil
+}
+
+// Gets a URL without its query string or fragment, and whether it had a query
+func queryPath(u string) (string, bool) {
+	if i := strings.Index(u, "#"); i >= 0 {
+		u = u[:i]
+	}
+	if i := strings.Index(u, "?"); i >= 0 {
+		return u[:i], true
+	}
+	return u, false
+}
+
+// Gets a URL up to the last "/" in its path, without any query or fragment
+func seedDir(u string) string {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	if i := strings.LastIndex(u, "/"); i >= 0 && !strings.HasSuffix(u[:i], "/") {
+		return u[:i+1]
+	}
+	return u + "/"
+}
+
+// Gets slices of links and assets from a goquery.Document
+func GetAttributesFromDocument(doc *goquery.Document) (links []string, assets []string) {
+	return GetLinksFromDocument(doc), GetAssetsFromDocument(doc)
+}
+
+// Gets a slice of links from a goquery.Document
+func GetLinksFromDocument(doc *goquery.Document) []string {
+	// Links without "#" or empty links
+	return doc.Find("a[href]").Not("a[href='#']").Not("a[href='']").
+		Map(func(_ int, s *goquery.Selection) string {
+			href, _ := s.Attr("href")
+			return href
+		})
+}
+
+// Gets a slice of assets from a goquery.Document
+func GetAssetsFromDocument(doc *goquery.Document) []string {
+	// CSS and other "link" elements
+	assets := doc.Find("link[href]").Map(func(i int, s *goquery.Selection) string {
+		href, _ := s.Attr("href")
+		return href
+	})
+
+	//Anything with the "src" attribute (media or scripts)
+	assets = append(
+		assets,
+		doc.Find("[src]").Map(func(i int, s *goquery.Selection) string {
+			src, _ := s.Attr("src")
+			return src
+		})...)
+
+	return assets
+}
+
+// Grabs links and assets from a page at a URL
+func (u UrlParser) Parse(url string) (links []string, assets []string, err error) {
+	page, err := u.ParsePage(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	return page.Links, page.Assets, nil
+}
+
+// Fetches the page at a URL and builds a Page from its contents
+func (u UrlParser) ParsePage(url string) (*Page, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.ParseRequest(req)
+}
+
+// Sends a request and builds a Page from the response
+func (u UrlParser) ParseRequest(req *http.Request) (*Page, error) {
+	url := req.URL.String()
+	if !hasAllowedScheme(url) {
+		return nil, ErrUnsupportedScheme
+	}
+
+	var timings *timingTrace
+	if u.TraceTimings {
+		timings = &timingTrace{}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), timings.clientTrace()))
+	}
+
+	u.setUserAgent(req)
+
+	res, err := u.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if !u.acceptsStatus(res.StatusCode) {
+		statusErr := &StatusError{Code: res.StatusCode, Url: url}
+		if u.CaptureErrorBody {
+			statusErr.Body = u.errorBody(res.Body)
+		}
+		return nil, statusErr
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(body)
+
+	page := Page{
+		Url:         url,
+		ContentHash: hex.EncodeToString(hash[:]),
+		Children:    make(map[string]*Page),
+		Headers:     u.selectHeaders(res.Header),
+		Size:        int64(len(body)),
+
+		RedirectChain: redirectChain(res),
+		LinkHeaders:   parseLinkHeaders(res.Header, res.Request.URL.String()),
+	}
+
+	if u.StoreBody {
+		page.Body = string(body)
+	}
+
+	if timings != nil {
+		page.Timings = timings.result()
+	}
+
+	if u.CaptureTLSInfo {
+		page.TLS = tlsInfo(res.TLS)
+	}
+
+	if modified, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		page.LastModified = &modified
+	}
+
+	if u.HTMLOnly && !isHTML(res.Header, body) {
+		return &page, nil
+	}
+
+	if err := u.parseBody(&page, body, res.Request.URL); err != nil {
+		return nil, err
+	}
+
+	if u.FollowPagination {
+		u.addLinks(&page, SourceLinkHeader, headerPaginationLinks(page.LinkHeaders, res.Request.URL.String())...)
+	}
+
+	if len(page.stylesheets) > 0 {
+		u.addCSSAssets(req.Context(), &page)
+	}
+
+	if u.ClassifyAssets {
+		page.TypedAssets = classifyAssets(page.Assets)
+	}
+
+	page.MixedContent = mixedContent(res.Request.URL, page.Assets)
+
+	return &page, nil
+}
+
+// Reads the start of an error response's body for StatusError.Body,
+// trimmed and cut down to ErrorBodyBytes
+func (u UrlParser) errorBody(body io.Reader) string {
+	limit := u.ErrorBodyBytes
+	if limit <= 0 {
+		limit = 512
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(body, int64(limit)))
+	return strings.ToValidUTF8(strings.TrimSpace(string(b)), "")
+}
+
+// Gets the URLs a response was redirected through, nil if it wasn't redirected
+func redirectChain(res *http.Response) []string {
+	req := res.Request
+	chain := []string{req.URL.String()}
+	for req.Response != nil {
+		req = req.Response.Request
+		chain = append([]string{req.URL.String()}, chain...)
+	}
+
+	if len(chain) < 2 {
+		return nil
+	}
+	return chain
+}
+
+// Gets the client to send requests with
+func (u UrlParser) client() *http.Client {
+	if u.Client != nil {
+		return u.Client
+	}
+	return http.DefaultClient
+}
+
+// Sets the request's User-Agent from UserAgent or UserAgents, unless it
+// already has one
+func (u UrlParser) setUserAgent(req *http.Request) {
+	if req.Header.Get("User-Agent") != "" {
+		return
+	}
+
+	agent := u.UserAgent
+	if len(u.UserAgents) > 0 {
+		pick := rand.Intn
+		if u.rand != nil {
+			pick = u.rand.Intn
+		}
+		agent = u.UserAgents[pick(len(u.UserAgents))]
+	}
+	if agent != "" {
+		req.Header.Set("User-Agent", agent)
+	}
+}
+
+// Parses a response body into page, giving up if it takes longer than ParseTimeout.
+// A timed out parse is abandoned rather than stopped, it finishes in the background.
+func (u UrlParser) parseBody(page *Page, body []byte, base *url.URL) error {
+	if u.ParseTimeout <= 0 {
+		return u.parseDocument(page, body, base)
+	}
+
+	clock := u.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	parsed := *page
+	done := make(chan error, 1)
+	go func() {
+		done <- u.parseDocument(&parsed, body, base)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			*page = parsed
+		}
+		return err
+	case <-clock.After(u.ParseTimeout):
+		return ErrParseTimeout
+	}
+}
+
+// Checks whether to collect assets, which is unless CollectAssets is false
+func (u UrlParser) collectAssets() bool {
+	return u.CollectAssets == nil || *u.CollectAssets
+}
+
+// Builds a document from a response body and extracts what we need from it into page
+func (u UrlParser) parseDocument(page *Page, body []byte, base *url.URL) error {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrParse, err)
+	}
+
+	if u.collectAssets() {
+		page.Links, page.Assets = GetAttributesFromDocument(doc)
+	} else {
+		page.Links = GetLinksFromDocument(doc)
+	}
+	u.noteSources(page, SourceLink, page.Links)
+
+	if u.RecordLinkText {
+		page.TextLinks = GetLinkTextFromDocument(doc)
+	}
+
+	if u.FollowAreaLinks {
+		u.addLinks(page, SourceArea, GetAreaLinksFromDocument(doc)...)
+	}
+
+	if u.FollowFormActions {
+		u.addLinks(page, SourceForm, GetFormActionsFromDocument(doc)...)
+	}
+
+	page.Alternates = GetAlternatesFromDocument(doc, base.String())
+	page.Robots = GetMetaRobotsFromDocument(doc)
+	page.Next, page.Prev = GetPaginationFromDocument(doc, base.String())
+
+	if u.RecordOpenGraph {
+		page.OpenGraph = GetOpenGraphFromDocument(doc, base.String())
+	}
+
+	if u.ParseJSONLD {
+		u.addLinks(page, SourceJSONLD, GetJSONLDLinksFromDocument(doc, base.String())...)
+	}
+
+	if u.FollowMetaRefresh {
+		if target := GetMetaRefresh(doc); target != "" {
+			u.addLinks(page, SourceMetaRefresh, resolveUrl(base.String(), target))
+		}
+	}
+
+	if u.FollowPagination && page.Next != "" {
+		u.addLinks(page, SourcePagination, page.Next)
+	}
+
+	if u.FollowCanonical {
+		if canonical := GetCanonicalFromDocument(doc, base.String()); canonical != "" && canonical != base.String() {
+			u.addLinks(page, SourceCanonical, canonical)
+		}
+	}
+
+	if u.ParseCSSAssets && u.collectAssets() {
+		page.stylesheets = GetStylesheetsFromDocument(doc, base.String())
+		parseInlineCSS(page, doc, base.String())
+	}
+
+	if u.RecordFragments {
+		page.Links, page.Fragments = splitFragments(page.Links)
+	}
+
+	if u.CleanUrls {
+		cleanUrls(page.Links)
+		if page.linkSources != nil {
+			cleaned := make(map[string]string, len(page.linkSources))
+			for l, source := range page.linkSources {
+				cleaned[cleanUrl(l)] = source
+			}
+			page.linkSources = cleaned
+		}
+		cleanUrls(page.Assets)
+		for i := range page.TextLinks {
+			page.TextLinks[i].Url = cleanUrl(page.TextLinks[i].Url)
+		}
+	}
+
+	return nil
+}
+
+// Separates fragment-only links from the rest, dropping repeats of fragments
+func splitFragments(all []string) (links []string, fragments []string) {
+	seen := make(map[string]bool)
+	for _, l := range all {
+		if f := strings.TrimSpace(l); !strings.HasPrefix(f, "#") {
+			links = append(links, l)
+		} else if !seen[f] {
+			seen[f] = true
+			fragments = append(fragments, f)
+		}
+	}
+	return links, fragments
+}
+
+// Gets the assets that a page at base would load over http when it's https
+func mixedContent(base *url.URL, assets []string) []string {
+	if !strings.EqualFold(base.Scheme, "https") {
+		return nil
+	}
+
+	var insecure []string
+	for _, a := range assets {
+		resolved := resolveUrl(base.String(), strings.TrimSpace(a))
+		if u, err := url.Parse(resolved); err == nil && strings.EqualFold(u.Scheme, "http") {
+			insecure = append(insecure, resolved)
+		}
+	}
+	return insecure
+}
+
+// Cleans each URL in place, see cleanUrl
+func cleanUrls(urls []string) {
+	for i, u := range urls {
+		urls[i] = cleanUrl(u)
+	}
+}
+
+// Cleans a URL the way browsers do: trims leading and trailing whitespace and
+// control characters, removes tabs and newlines, percent-encodes any other
+// spaces and lowercases the host
+func cleanUrl(rawUrl string) string {
+	cleaned := strings.TrimFunc(rawUrl, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+	cleaned = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, cleaned)
+	cleaned = strings.ReplaceAll(cleaned, " ", "%20")
+
+	u, err := url.Parse(cleaned)
+	if err != nil || u.Host == "" {
+		return cleaned
+	}
+
+	i := strings.Index(cleaned, u.Host)
+	if i < 0 {
+		return cleaned
+	}
+	return cleaned[:i] + strings.ToLower(u.Host) + cleaned[i+len(u.Host):]
+}
+
+// Checks whether a response is HTML from its Content-Type, sniffing the
+// body when the header is missing
+func isHTML(header http.Header, body []byte) bool {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// Picks out the configured subset of response headers, nil if none were found
+func (u UrlParser) selectHeaders(header http.Header) map[string]string {
+	var selected map[string]string
+	for _, name := range u.RecordHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if selected == nil {
+			selected = make(map[string]string)
+		}
+		selected[http.CanonicalHeaderKey(name)] = value
+	}
+	return selected
+}
+
+// Checks whether a response status code counts as a successful fetch
+func (u UrlParser) acceptsStatus(code int) bool {
+	if len(u.AcceptedStatusCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range u.AcceptedStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the target URL of a <meta http-equiv="refresh"> redirect, if any
+func GetMetaRefresh(doc *goquery.Document) string {
+	target := ""
+	doc.Find("meta[http-equiv][content]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		equiv, _ := s.Attr("http-equiv")
+		if !strings.EqualFold(strings.TrimSpace(equiv), "refresh") {
+			return true
+		}
+		content, _ := s.Attr("content")
+		target = parseMetaRefresh(content)
+		return false
+	})
+	return target
+}
+
+// Extracts the URL from a refresh directive such as "0; url='/next.html'"
+func parseMetaRefresh(content string) string {
+	i := strings.Index(content, ";")
+	if i < 0 {
+		i = strings.Index(content, ",")
+	}
+	if i < 0 {
+		return ""
+	}
+
+	target := strings.TrimSpace(content[i+1:])
+	if len(target) >= 3 && strings.EqualFold(target[:3], "url") {
+		rest := strings.TrimSpace(target[3:])
+		if strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+
+	return strings.Trim(target, `"'`)
+}
+
+// Checks that a URL uses one of the schemes the crawler is willing to fetch
+func hasAllowedScheme(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// Resolves a possibly relative reference against the URL of the page it was found on
+func resolveUrl(base string, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
 }
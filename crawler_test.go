@@ -1,14 +1,21 @@
 package gowebcrawler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -45,6 +52,25 @@ func TestCrawlRootPageNotFound(t *testing.T) {
 	assert.Error(t, err, "Did not get an error")
 }
 
+func TestCrawlContinuesOnRootError(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.ContinueOnRootError = true
+	path := "/404"
+	j, err := crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	expectedUrl := fmt.Sprint(ts.URL, path)
+	assert.Equal(t, expectedUrl, m["Url"], "Did not get the expected URL")
+	assert.Contains(t, m["Error"], "404", "Root error was not recorded")
+	assert.Len(t, m["Children"], 0, "Children is not empty")
+}
+
 func TestCrawlThreeLevels(t *testing.T) {
 	ts, _ := createTestServer()
 	defer ts.Close()
@@ -94,6 +120,23 @@ func TestCrawlDoesntFollowExternalLinks(t *testing.T) {
 	assert.Len(t, m["Children"], 0, "Children is not nil")
 }
 
+func TestRunCountsHosts(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/hosts.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+
+	expected := map[string]int{
+		"google.com":                          2,
+		"example.org":                         1,
+		strings.TrimPrefix(ts.URL, "http://"): 1,
+	}
+	assert.Equal(t, expected, result.Hosts, "Didn't count links per host")
+}
+
 func TestCrawlFindsAssets(t *testing.T) {
 	ts, _ := createTestServer()
 	defer ts.Close()
@@ -111,6 +154,32 @@ func TestCrawlFindsAssets(t *testing.T) {
 	assert.Len(t, m["Assets"], 3, "Didn't find 3 assets")
 }
 
+func TestCrawlSkipsAssets(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	collect := false
+	crawler := WebCrawler{
+		Parser:  &UrlParser{CollectAssets: &collect},
+		RootUrl: ts.URL,
+	}
+
+	path := "/assets.html"
+	j, err := crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	assert.Nil(t, m["Assets"], "Assets is not nil")
+
+	collect = true
+	j, err = crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+	assert.Len(t, jsonToMap(j)["Assets"], 3, "Didn't collect assets with CollectAssets set")
+}
+
 func TestCrawlDoesntRepeatRequests(t *testing.T) {
 	ts, requestCount := createTestServer()
 	defer ts.Close()
@@ -124,6 +193,82 @@ func TestCrawlDoesntRepeatRequests(t *testing.T) {
 	assert.Equal(t, 3, *requestCount, "Didn't make the right amount of requests")
 }
 
+func TestRunTriesDeadLinksOnce(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	missingRequests := 0
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dead/missing.html" {
+			missingRequests++
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/dead/1.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+
+	missingUrl := fmt.Sprint(ts.URL, "/dead/missing.html")
+	assert.Equal(t, 1, missingRequests, "Requested the dead link more than once")
+	assert.Len(t, result.DeadLinks, 1, "DeadLinks length is not 1")
+	assert.Contains(t, result.DeadLinks[missingUrl], "404", "Dead link error not recorded")
+}
+
+func TestCrawlIncludesFailedPages(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.IncludeFailedPages = true
+	j, err := crawler.Crawl("/dead/3.html")
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	children := m["Children"].(map[string]interface{})
+	missingUrl := fmt.Sprint(ts.URL, "/dead/missing.html")
+	missing := children[missingUrl].(map[string]interface{})
+	assert.Equal(t, missingUrl, missing["Url"], "Did not get the expected URL")
+	assert.Contains(t, missing["Error"], "404", "Stub page has no error")
+	assert.Len(t, missing["Children"], 0, "Stub page has children")
+}
+
+func TestCrawlIncludeFailedPagesOnlyAddsFetches(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="http://google.example/x"><a href="mailto:a@b.c"><a href="/missing">`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.IncludeFailedPages = true
+	root := crawlToPage(t, crawler, "/")
+
+	assert.Len(t, root.Children, 1, "Added stubs for links that weren't fetched")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/missing"), "Didn't add a stub for the failed fetch")
+}
+
+func TestRunSkippedLinksArentDead(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="http://google.example/x"><a href="mailto:a@b.c">`))
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Empty(t, result.DeadLinks, "Recorded skipped links as dead")
+}
+
 func TestCrawlRespectsFetchLimit(t *testing.T) {
 	ts, requestCount := createTestServer()
 	defer ts.Close()
@@ -142,6 +287,332 @@ func TestCrawlRespectsFetchLimit(t *testing.T) {
 	assert.Equal(t, 2, *requestCount, "Didn't make the right amount of requests")
 }
 
+func TestCrawlFetchLimitCanCountSuccesses(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.FetchLimit = 3
+	result, err := crawler.Run("/broken_links/1.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 3, *requestCount, "Didn't make the right amount of requests")
+	assert.Len(t, result.Root.Flatten(), 1, "Failed fetches didn't count towards the limit")
+
+	*requestCount = 0
+	crawler.FetchLimitCountsSuccesses = true
+	result, err = crawler.Run("/broken_links/1.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 5, *requestCount, "Didn't make the right amount of requests")
+	assert.Len(t, result.Root.Flatten(), 3, "Didn't fetch 3 good pages")
+	assert.Len(t, result.DeadLinks, 2, "Didn't record the failed fetches")
+}
+
+func TestCrawlCollapsesIndexPages(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.CollapseIndexPages = true
+	root := crawlToPage(t, crawler, "/index_pages/start.html")
+
+	assert.Equal(t, 2, *requestCount, "Didn't make the right amount of requests")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/index_pages/docs/index.html"), "Index page was not crawled")
+
+	*requestCount = 0
+	crawler.IndexFiles = []string{"home.html"}
+	crawlToPage(t, crawler, "/index_pages/start.html")
+
+	assert.Equal(t, 4, *requestCount, "Didn't use the configured index files")
+}
+
+func TestCollapseIndex(t *testing.T) {
+	assert.Equal(t, "http://a.com/dir/", collapseIndex("http://a.com/dir/index.html", defaultIndexFiles))
+	assert.Equal(t, "http://a.com/dir/?q=1", collapseIndex("http://a.com/dir/default.html?q=1", defaultIndexFiles))
+	assert.Equal(t, "http://a.com/dir/myindex.html", collapseIndex("http://a.com/dir/myindex.html", defaultIndexFiles))
+	assert.Equal(t, "http://a.com/dir/", collapseIndex("http://a.com/dir/", defaultIndexFiles))
+}
+
+func TestCrawlJitterSpreadsRequests(t *testing.T) {
+	var mu sync.Mutex
+	requested := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			for i := 0; i < 10; i++ {
+				fmt.Fprintf(w, `<a href="/%d">`, i)
+			}
+			return
+		}
+		mu.Lock()
+		requested++
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	crawler := getCrawler(ts.URL)
+	crawler.Clock = clock
+	crawler.Jitter = 100 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		_, err := crawler.Crawl("/")
+		done <- err
+	}()
+
+	// Every link waits on the clock for its own share of the jitter
+	clock.BlockUntil(10)
+	clock.mu.Lock()
+	delays := map[time.Duration]bool{}
+	for _, w := range clock.waiters {
+		delay := w.at.Sub(start)
+		assert.True(t, delay > 0 && delay < crawler.Jitter, "Delay %v is outside the jitter", delay)
+		delays[delay] = true
+	}
+	clock.mu.Unlock()
+	assert.Greater(t, len(delays), 1, "Delays didn't vary")
+
+	mu.Lock()
+	assert.Equal(t, 0, requested, "Links were fetched before their delay")
+	mu.Unlock()
+
+	clock.Advance(crawler.Jitter)
+	assert.Nil(t, <-done, "Got an error from Crawl")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 10, requested, "Didn't fetch every link")
+}
+
+func TestCrawlMaxConcurrencyRampUp(t *testing.T) {
+	// Fetches hold on until released, so the number running only changes
+	// when the test lets one finish
+	var mu sync.Mutex
+	running, most := 0, 0
+	started := make(chan bool, 40)
+	release := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			for i := 0; i < 40; i++ {
+				fmt.Fprintf(w, `<a href="/%d">`, i)
+			}
+			return
+		}
+
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		started <- true
+
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	crawler := getCrawler(ts.URL)
+	crawler.Clock = clock
+	crawler.MaxConcurrency = 8
+	crawler.RampUp = 200 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		_, err := crawler.Crawl("/")
+		done <- err
+	}()
+
+	// Waits for n more fetches to start and gets how many are running
+	waitForStarts := func(n int) int {
+		for i := 0; i < n; i++ {
+			<-started
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return running
+	}
+
+	assert.Equal(t, 1, waitForStarts(1), "Didn't start with one fetch at a time")
+
+	// Halfway through the ramp up, the limit is 1 + 7/2
+	clock.Advance(100 * time.Millisecond)
+	release <- true
+	assert.Equal(t, 4, waitForStarts(4), "Concurrency didn't ramp up")
+
+	clock.Advance(100 * time.Millisecond)
+	release <- true
+	assert.Equal(t, 8, waitForStarts(5), "Didn't reach MaxConcurrency after the ramp up")
+
+	close(release)
+	assert.Nil(t, <-done, "Got an error from Crawl")
+	assert.Len(t, started, 40-10, "Didn't fetch every link")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 8, most, "Went over MaxConcurrency")
+}
+
+func TestCrawlRetriesFailedFetches(t *testing.T) {
+	flakyRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/flaky">`))
+		case "/flaky":
+			if flakyRequests++; flakyRequests < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxRetries = 2
+	root := crawlToPage(t, crawler, "/")
+
+	assert.Equal(t, 3, flakyRequests, "Didn't retry the flaky page")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/flaky"), "Flaky page was not crawled")
+}
+
+func TestCrawlRetriesShortBodies(t *testing.T) {
+	flakyRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/flaky">`))
+		case "/flaky":
+			if flakyRequests++; flakyRequests > 1 {
+				w.Write([]byte(`<p>Real content</p>`))
+			}
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MinBodyBytes = 10
+	crawler.MaxRetries = 2
+	root := crawlToPage(t, crawler, "/")
+
+	assert.Equal(t, 2, flakyRequests, "Didn't retry the empty page")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/flaky"), "Flaky page was not crawled")
+
+	flakyRequests = 0
+	crawler.MaxRetries = 0
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 1, flakyRequests, "Retried without MaxRetries")
+	assert.Contains(t, result.DeadLinks, fmt.Sprint(ts.URL, "/flaky"), "Empty page wasn't recorded as dead")
+}
+
+func TestCrawlRetryableFunc(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/missing"><a href="/error">`))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	var codes []int
+	crawler := getCrawler(ts.URL)
+	crawler.MaxRetries = 2
+	crawler.RetryableFunc = func(statusCode int, err error) bool {
+		mu.Lock()
+		codes = append(codes, statusCode)
+		mu.Unlock()
+		return statusCode == http.StatusNotFound
+	}
+	_, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]int{"/": 1, "/missing": 3, "/error": 1}, requests, "Didn't use the custom retry policy")
+	assert.Contains(t, codes, http.StatusInternalServerError, "Status code wasn't passed to RetryableFunc")
+}
+
+func TestCrawlRetriesAndFetchLimit(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/flaky"><a href="/a"><a href="/b">`))
+		case "/flaky":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.FetchLimit = 3
+	crawler.MaxRetries = 3
+	crawler.RetriesCountTowardsLimits = true
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]int{"/": 1, "/flaky": 1, "/a": 1}, requests, "Retries went over the fetch limit")
+	assert.Contains(t, result.DeadLinks, fmt.Sprint(ts.URL, "/flaky"), "Flaky page wasn't recorded as dead")
+
+	requests = map[string]int{}
+	crawler.RetriesCountTowardsLimits = false
+	_, err = crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]int{"/": 1, "/flaky": 4, "/a": 1}, requests, "Retries didn't ignore the fetch limit")
+}
+
+func TestCrawlCountsAttempts(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/flaky"><a href="/a"><a href="/b"><a href="http://example.com/">`))
+		case "/flaky":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxRetries = 3
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 7, result.Attempts, "Attempts didn't count every request")
+	assert.Greater(t, result.Attempts, len(result.URLs()), "Retries weren't counted as attempts")
+
+	requests = map[string]int{}
+	crawler.MaxAttempts = 4
+	result, err = crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 4, result.Attempts, "Went over MaxAttempts")
+	assert.Equal(t, map[string]int{"/": 1, "/flaky": 1, "/a": 1, "/b": 1}, requests, "Didn't stop at MaxAttempts")
+	assert.Contains(t, result.DeadLinks, fmt.Sprint(ts.URL, "/flaky"), "Flaky page wasn't recorded as dead")
+}
+
 func TestCrawlDoesntIncludeInvalidLinks(t *testing.T) {
 	ts, _ := createTestServer()
 	defer ts.Close()
@@ -156,35 +627,924 @@ func TestCrawlDoesntIncludeInvalidLinks(t *testing.T) {
 	assert.Nil(t, m["Links"], "Found links when it shouldn't have.")
 }
 
-// Test server that fetches pages from a local directory
-func createTestServer() (*httptest.Server, *int) {
-	requestCount := 0
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestCount++
-		body, err := ioutil.ReadFile(path.Join(BasePath, r.URL.Path))
+func TestCrawlFollowsMetaRefresh(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
 
-		if err != nil {
-			//404 when file doesn't exist or other error
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.Write(body)
-		}
-	}))
+	crawler := WebCrawler{
+		Parser:  &UrlParser{FollowMetaRefresh: true},
+		RootUrl: ts.URL,
+	}
 
-	return ts, &requestCount
+	path := "/meta_refresh.html"
+	j, err := crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	targetUrl := fmt.Sprint(ts.URL, "/example.com.html")
+	assert.Equal(t, []interface{}{targetUrl}, m["Links"], "Meta refresh target not in links")
+	children := m["Children"].(map[string]interface{})
+	assert.Contains(t, children, targetUrl, "Meta refresh target was not crawled")
 }
 
-func jsonToMap(j []byte) map[string]interface{} {
-	var f interface{}
-	json.Unmarshal(j, &f)
-	return f.(map[string]interface{})
+func TestCrawlIgnoresMetaRefreshByDefault(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	path := "/meta_refresh.html"
+	j, err := crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	assert.Nil(t, m["Links"], "Found links when it shouldn't have.")
+	assert.Equal(t, 1, *requestCount, "Didn't make the right amount of requests")
 }
 
-func getCrawler(rootUrl string) WebCrawler {
+func TestCrawlRejectsUnsupportedSchemes(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	path := "/ftp_links.html"
+	j, err := crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	assert.Len(t, m["Links"], 1, "Links length is not 1")
+	assert.Len(t, m["Children"], 0, "Children is not nil")
+	assert.Equal(t, 1, *requestCount, "Didn't make the right amount of requests")
+
+	ftpCrawler := getCrawler("ftp://ftp.example.com")
+	_, err = ftpCrawler.fetchPage(context.Background(), "ftp://ftp.example.com/file.txt")
+	assert.Equal(t, ErrUnsupportedScheme, err, "Did not reject the ftp scheme")
+
+	_, _, err = (&UrlParser{}).Parse("ftp://ftp.example.com/file.txt")
+	assert.Equal(t, ErrUnsupportedScheme, err, "Parser did not reject the ftp scheme")
+}
+
+func TestCrawlAcceptsNon200SuccessCodes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		w.Write([]byte(`<a href="/other.html">`))
+	}))
+	defer ts.Close()
+
 	crawler := WebCrawler{
-		Parser:  &UrlParser{},
-		RootUrl: rootUrl,
+		Parser:     &UrlParser{},
+		RootUrl:    ts.URL,
+		FetchLimit: 1,
 	}
 
-	return crawler
+	j, err := crawler.Crawl("/")
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	assert.Len(t, m["Links"], 1, "Links length is not 1")
+
+	crawler.Parser = &UrlParser{AcceptedStatusCodes: []int{http.StatusOK}}
+	_, err = crawler.Crawl("/")
+
+	assert.Error(t, err, "Did not get an error for a status code outside the accepted set")
+}
+
+func TestCrawlCapturesErrorBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/blocked">`))
+		case "/blocked":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("\n  Request blocked by firewall. Incident ID: 12345\n" + strings.Repeat("x", 1000)))
+		}
+	}))
+	defer ts.Close()
+
+	blocked := fmt.Sprint(ts.URL, "/blocked")
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.NotContains(t, result.DeadLinks[blocked], "firewall", "Captured the body by default")
+
+	crawler.Parser.CaptureErrorBody = true
+	crawler.Parser.ErrorBodyBytes = 64
+	result, err = crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Contains(t, result.DeadLinks[blocked], "403", "Lost the status code")
+	assert.Contains(t, result.DeadLinks[blocked], `body: "Request blocked by firewall. Incident ID: 12345\n`, "Didn't capture the body")
+
+	_, err = crawler.Parser.ParsePage(blocked)
+	var statusErr *StatusError
+	if assert.ErrorAs(t, err, &statusErr, "Didn't get a StatusError") {
+		assert.Len(t, statusErr.Body, 61, "Body wasn't cut down to ErrorBodyBytes")
+	}
+}
+
+func TestCrawlPageHookDropsPages(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.PageHook = func(p *Page) *Page {
+		if strings.HasSuffix(p.Url, "/circular/2.html") {
+			return nil
+		}
+		return p
+	}
+
+	path := "/circular/1.html"
+	j, err := crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	children := m["Children"].(map[string]interface{})
+	assert.Len(t, children, 1, "Children length is not 1")
+	assert.NotContains(t, children, fmt.Sprint(ts.URL, "/circular/2.html"), "Dropped page was stored")
+	assert.Contains(t, children, fmt.Sprint(ts.URL, "/circular/3.html"), "Kept page was not stored")
+}
+
+func TestCrawlPageHookAnnotatesPages(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.PageHook = func(p *Page) *Page {
+		p.Assets = append(p.Assets, "annotated")
+		return p
+	}
+
+	path := "/three/1.html"
+	j, err := crawler.Crawl(path)
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	assert.Equal(t, []interface{}{"annotated"}, m["Assets"], "Root page was not annotated")
+	two := m["Children"].(map[string]interface{})[fmt.Sprint(ts.URL, "/three/2.html")].(map[string]interface{})
+	assert.Equal(t, []interface{}{"annotated"}, two["Assets"], "Child page was not annotated")
+}
+
+func TestParsePageCleansUrls(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	parser := UrlParser{CleanUrls: true}
+	page, err := parser.ParsePage(fmt.Sprint(ts.URL, "/messy_links.html"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+
+	assert.Equal(t, []string{
+		"/three/1.html",
+		"/three/1.html",
+		"HTTP://www.example.com/Some/Path",
+	}, page.Links, "Didn't clean the links")
+	assert.Equal(t, []string{"/static/site.css"}, page.Assets, "Didn't clean the assets")
+}
+
+func TestCleanUrlKeepsInternalSpaces(t *testing.T) {
+	assert.Equal(t, "/files/annual%20report.pdf", cleanUrl(" /files/annual report.pdf\n"), "Didn't encode the internal space")
+	assert.Equal(t, "/files/annual%20report.pdf", cleanUrl("/files/annual\t re\r\nport.pdf"), "Didn't remove tabs and newlines")
+	assert.Equal(t, "http://example.com/a%20b", cleanUrl("\x00http://EXAMPLE.com/a b "), "Didn't trim the control character")
+}
+
+func TestCrawlCleanUrlsAvoidsDuplicates(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.CleanUrls = true
+	root := crawlToPage(t, crawler, "/messy_links.html")
+
+	assert.Equal(t, 4, *requestCount, "Didn't make the right amount of requests")
+	assert.Len(t, root.Children, 1, "Children length is not 1")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/three/1.html"), "Cleaned link was not crawled")
+}
+
+func TestCrawlStoresBody(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	root := crawlToPage(t, crawler, "/three/1.html")
+	assert.Equal(t, "", root.Body, "Stored the body by default")
+
+	crawler.Parser.StoreBody = true
+	root = crawlToPage(t, crawler, "/three/1.html")
+
+	one, _ := ioutil.ReadFile(path.Join(BasePath, "three/1.html"))
+	two, _ := ioutil.ReadFile(path.Join(BasePath, "three/2.html"))
+	assert.Equal(t, string(one), root.Body, "Stored body doesn't match the fixture")
+	assert.Equal(t, string(two), root.Children[fmt.Sprint(ts.URL, "/three/2.html")].Body, "Stored body doesn't match the fixture")
+}
+
+func TestParsePageHTMLOnly(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/untyped":
+			// Stop the server from sniffing and setting a type itself
+			w.Header()["Content-Type"] = nil
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.Write([]byte(`<!DOCTYPE html><html><body><a href="/next.html">Next</a></body></html>`))
+	}))
+	defer ts.Close()
+
+	parser := UrlParser{HTMLOnly: true}
+
+	page, err := parser.ParsePage(fmt.Sprint(ts.URL, "/untyped"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Equal(t, []string{"/next.html"}, page.Links, "Didn't parse HTML served without a Content-Type")
+
+	page, err = parser.ParsePage(fmt.Sprint(ts.URL, "/text"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Empty(t, page.Links, "Parsed a response that isn't HTML")
+
+	parser.HTMLOnly = false
+	page, err = parser.ParsePage(fmt.Sprint(ts.URL, "/text"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Equal(t, []string{"/next.html"}, page.Links, "Didn't parse every response by default")
+}
+
+func TestParsePageRecordsRedirectChain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/older", http.StatusMovedPermanently)
+		case "/older":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	parser := UrlParser{}
+
+	page, err := parser.ParsePage(fmt.Sprint(ts.URL, "/old"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Equal(t, []string{
+		fmt.Sprint(ts.URL, "/old"),
+		fmt.Sprint(ts.URL, "/older"),
+		fmt.Sprint(ts.URL, "/new"),
+	}, page.RedirectChain, "Didn't record every hop")
+
+	page, err = parser.ParsePage(fmt.Sprint(ts.URL, "/new"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Nil(t, page.RedirectChain, "Recorded a chain without a redirect")
+}
+
+func TestCrawlSetsUserAgent(t *testing.T) {
+	var mu sync.Mutex
+	agents := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.UserAgent()]++
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			for i := 0; i < 30; i++ {
+				fmt.Fprintf(w, `<a href="/%d">`, i)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.UserAgent = "single-agent"
+	crawler.Crawl("/")
+	assert.Equal(t, map[string]int{"single-agent": 31}, agents, "Didn't send the User-Agent")
+
+	agents = make(map[string]int)
+	crawler.Parser.UserAgents = []string{"agent-a", "agent-b", "agent-c"}
+	crawler.Crawl("/")
+
+	assert.NotContains(t, agents, "single-agent", "UserAgents didn't take precedence over UserAgent")
+	assert.Greater(t, len(agents), 1, "Didn't rotate the User-Agent")
+	for agent := range agents {
+		assert.Contains(t, crawler.Parser.UserAgents, agent, "Sent an unknown User-Agent")
+	}
+}
+
+func TestParsePageRecordsSize(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	parser := UrlParser{}
+	page, err := parser.ParsePage(fmt.Sprint(ts.URL, "/assets.html"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+
+	fixture, _ := ioutil.ReadFile(path.Join(BasePath, "assets.html"))
+	assert.Equal(t, int64(len(fixture)), page.Size, "Size doesn't match the fixture")
+}
+
+func TestParsePageContentHash(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	parser := UrlParser{}
+
+	circular, err := parser.ParsePage(fmt.Sprint(ts.URL, "/circular/3.html"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+	three, err := parser.ParsePage(fmt.Sprint(ts.URL, "/three/3.html"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+	other, err := parser.ParsePage(fmt.Sprint(ts.URL, "/three/1.html"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+
+	assert.Len(t, circular.ContentHash, 64, "Content hash is not a hex SHA-256")
+	assert.Equal(t, circular.ContentHash, three.ContentHash, "Identical pages have different hashes")
+	assert.NotEqual(t, circular.ContentHash, other.ContentHash, "Different pages have the same hash")
+}
+
+func TestCrawlMaxPerDepth(t *testing.T) {
+	var mu sync.Mutex
+	requestCount := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requestCount++
+		mu.Unlock()
+
+		// Every page links to 5 pages a level further down
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(w, `<a href="%s/%d">`, strings.TrimSuffix(r.URL.Path, "/"), i)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxPerDepth = 3
+	crawler.FetchLimit = 13
+
+	root := crawlToPage(t, crawler, "/")
+	perDepth := make(map[int]int)
+	maxDepth := 0
+	Walk(root, func(depth int, p *Page) bool {
+		perDepth[depth]++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		return true
+	})
+
+	assert.Equal(t, 13, requestCount, "Didn't make the right amount of requests")
+	assert.Equal(t, 4, maxDepth, "Didn't reach deeper levels")
+	for depth := 1; depth <= maxDepth; depth++ {
+		assert.Equal(t, 3, perDepth[depth], fmt.Sprintf("Wrong number of pages at depth %d", depth))
+	}
+}
+
+func TestCrawlRecordsSequence(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	root := crawlToPage(t, crawler, "/duplicates/start.html")
+	pages := root.Flatten()
+	assert.Len(t, pages, 4, "Didn't crawl every page")
+
+	assert.Equal(t, 0, root.Seq, "Root isn't first in the sequence")
+
+	seqs := make([]int, len(pages))
+	for i, p := range pages {
+		seqs[i] = p.Seq
+	}
+	sort.Ints(seqs)
+	for i, seq := range seqs {
+		assert.Equal(t, i, seq, "Sequence numbers aren't unique and contiguous")
+	}
+
+	j, err := json.Marshal(root)
+	assert.Nil(t, err, "Got an error from Marshal")
+	assert.Contains(t, string(j), `"Seq":0`, "Left the root's sequence number out of the JSON")
+}
+
+func TestCrawlMaxFollowPerPage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			// Start with a link back to this page, which isn't followed again
+			fmt.Fprint(w, `<a href="/">`)
+			for i := 0; i < 50; i++ {
+				fmt.Fprintf(w, `<a href="/%d">`, i)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxFollowPerPage = 5
+	root := crawlToPage(t, crawler, "/")
+
+	assert.Len(t, root.Links, 51, "Didn't record every link")
+	assert.Len(t, root.Children, 5, "Didn't follow the right amount of links")
+	for i := 0; i < 5; i++ {
+		assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/", i), "Didn't follow the first links")
+	}
+}
+
+func TestCrawlMaxURLLength(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	long := "/" + strings.Repeat("session", 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<a href="/short"><a href="%s">`, long)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxURLLength = 200
+	root := crawlToPage(t, crawler, "/")
+
+	sort.Strings(requested)
+	assert.Equal(t, []string{"/", "/short"}, requested, "Fetched an overlong URL")
+	assert.Contains(t, root.Links, long, "Overlong link wasn't kept on the page")
+
+	requested = nil
+	crawler.MaxURLLength = 0
+	crawlToPage(t, crawler, "/")
+	assert.Len(t, requested, 3, "Didn't fetch every URL without a limit")
+}
+
+func TestCrawlConfineToSeedPath(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.ConfineToSeedPath = true
+	root := crawlToPage(t, crawler, "/confine/docs/intro.html")
+
+	assert.Equal(t, 3, *requestCount, "Didn't make the right amount of requests")
+	assert.Len(t, root.Children, 2, "Children length is not 2")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/confine/docs/sub/deep.html"), "Nested page was not crawled")
+	assert.NotContains(t, root.Children, fmt.Sprint(ts.URL, "/confine/about.html"), "Crawled outside the seed's directory")
+
+	*requestCount = 0
+	crawler.ConfineToSeedPath = false
+	crawlToPage(t, crawler, "/confine/docs/intro.html")
+	assert.Equal(t, 4, *requestCount, "Confined the crawl by default")
+}
+
+func TestSeedDir(t *testing.T) {
+	assert.Equal(t, "http://example.com/docs/", seedDir("http://example.com/docs/intro"))
+	assert.Equal(t, "http://example.com/docs/", seedDir("http://example.com/docs/"))
+	assert.Equal(t, "http://example.com/docs/", seedDir("http://example.com/docs/intro?page=a/b#c/d"))
+	assert.Equal(t, "http://example.com/", seedDir("http://example.com/index.html"))
+	assert.Equal(t, "http://example.com/", seedDir("http://example.com"))
+}
+
+func TestCrawlShouldFetch(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	asked := make(map[string]int)
+	crawler := getCrawler(ts.URL)
+	crawler.ShouldFetch = func(url string, depth int, parent *Page) bool {
+		asked[url] = depth
+		return !strings.HasPrefix(url, fmt.Sprint(ts.URL, "/confine/docs/sub/"))
+	}
+	root := crawlToPage(t, crawler, "/confine/docs/intro.html")
+
+	assert.Equal(t, 3, *requestCount, "Didn't make the right amount of requests")
+	assert.Len(t, root.Children, 2, "Children length is not 2")
+	assert.NotContains(t, root.Children, fmt.Sprint(ts.URL, "/confine/docs/sub/deep.html"), "Crawled a blocked page")
+	assert.Equal(t, 1, asked[fmt.Sprint(ts.URL, "/confine/docs/sub/deep.html")], "Wrong depth for a link")
+}
+
+func TestCrawlDetectsDuplicates(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.DetectDuplicates = true
+
+	result, err := crawler.Run("/duplicates/start.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	a, err := crawler.Parser.ParsePage(fmt.Sprint(ts.URL, "/duplicates/a.html"))
+	assert.Nil(t, err, "Got an error from ParsePage")
+
+	expected := map[string][]string{
+		a.ContentHash: {
+			fmt.Sprint(ts.URL, "/duplicates/a.html"),
+			fmt.Sprint(ts.URL, "/duplicates/b.html"),
+		},
+	}
+	assert.Equal(t, expected, result.Duplicates, "Didn't group the duplicate pages")
+}
+
+func TestCrawlRecordsSelectedHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Unwanted", "yes")
+		w.Write([]byte(`<p>headers</p>`))
+	}))
+	defer ts.Close()
+
+	crawler := WebCrawler{
+		Parser:  &UrlParser{RecordHeaders: []string{"cache-control", "X-Frame-Options", "Expires"}},
+		RootUrl: ts.URL,
+	}
+
+	j, err := crawler.Crawl("/")
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	expected := map[string]interface{}{
+		"Cache-Control":   "max-age=60",
+		"X-Frame-Options": "DENY",
+	}
+	assert.Equal(t, expected, m["Headers"], "Did not record the configured headers")
+}
+
+func TestCrawlSeedRequestCanBePost(t *testing.T) {
+	childMethod := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/child.html" {
+			childMethod = r.Method
+			w.Write([]byte(`<p>child</p>`))
+			return
+		}
+		if r.Method != "POST" || r.FormValue("token") != "secret" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte(`<a href="/child.html">`))
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	_, err := crawler.Crawl("/")
+
+	assert.Error(t, err, "Did not get an error for a GET on the gated page")
+
+	crawler.SeedMethod = "POST"
+	crawler.SeedBody = []byte("token=secret")
+	j, err := crawler.Crawl("/")
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	assert.Contains(t, m["Children"], fmt.Sprint(ts.URL, "/child.html"), "Child page was not crawled")
+	assert.Equal(t, "GET", childMethod, "Child page was not fetched with GET")
+}
+
+func TestParseTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat(`<div><a href="/page.html"><img src="/img.png"></a></div>`, 100000)))
+	}))
+	defer ts.Close()
+
+	parser := UrlParser{ParseTimeout: time.Millisecond}
+	_, err := parser.ParsePage(ts.URL)
+
+	assert.Equal(t, ErrParseTimeout, err, "Did not time out parsing an enormous page")
+
+	parser.ParseTimeout = time.Minute
+	page, err := parser.ParsePage(ts.URL)
+
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Len(t, page.Links, 100000, "Didn't find every link")
+}
+
+func TestParseErrorsAreDistinct(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(strings.Repeat(`<div><a href="/page.html"></a></div>`, 100000)))
+	}))
+
+	parser := UrlParser{ParseTimeout: time.Millisecond}
+	_, err := parser.ParsePage(ts.URL)
+	assert.True(t, errors.Is(err, ErrParse), "Parse failure isn't an ErrParse")
+
+	_, err = parser.ParsePage(fmt.Sprint(ts.URL, "/error"))
+	assert.NotNil(t, err, "Didn't get an error for a bad status")
+	assert.False(t, errors.Is(err, ErrParse), "Status error is an ErrParse")
+
+	ts.Close()
+	_, err = parser.ParsePage(ts.URL)
+	assert.NotNil(t, err, "Didn't get an error for a closed server")
+	assert.False(t, errors.Is(err, ErrParse), "Network error is an ErrParse")
+}
+
+func TestCrawlPrepareLogsIn(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok"})
+			return
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "ok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/private.html">`))
+		} else {
+			w.Write([]byte(`<p>private</p>`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	_, err := crawler.Crawl("/")
+
+	assert.Error(t, err, "Did not get an error without logging in")
+
+	crawler.Prepare = func(client *http.Client) error {
+		res, err := client.PostForm(ts.URL+"/login", nil)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	j, err := crawler.Crawl("/")
+
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+
+	assert.Contains(t, m["Children"], fmt.Sprint(ts.URL, "/private.html"), "Protected page was not crawled")
+}
+
+func TestCrawlPrepareErrorAborts(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Prepare = func(client *http.Client) error {
+		return fmt.Errorf("bad credentials")
+	}
+	_, err := crawler.Crawl("/three/1.html")
+
+	assert.Error(t, err, "Did not get an error")
+	assert.Equal(t, 0, *requestCount, "Made requests after Prepare failed")
+}
+
+func TestCrawlRespectsMaxTotalBytes(t *testing.T) {
+	requestCount := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		fmt.Fprintf(w, `<a href="/%d">`, n+1)
+		w.Write([]byte(strings.Repeat("<p>filler</p>", 1000)))
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxTotalBytes = 30000
+	j, err := crawler.Crawl("/1")
+
+	assert.Nil(t, err, "Got an error from Crawl")
+	assert.Equal(t, 3, requestCount, "Didn't make the right amount of requests")
+
+	var root Page
+	json.Unmarshal(j, &root)
+	assert.Len(t, root.Flatten(), 3, "Didn't return the partial site map")
+}
+
+// Test server that fetches pages from a local directory
+func createTestServer() (*httptest.Server, *int) {
+	requestCount := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		body, err := ioutil.ReadFile(path.Join(BasePath, r.URL.Path))
+
+		if err != nil {
+			//404 when file doesn't exist or other error
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.Write(body)
+		}
+	}))
+
+	return ts, &requestCount
+}
+
+func jsonToMap(j []byte) map[string]interface{} {
+	var f interface{}
+	json.Unmarshal(j, &f)
+	return f.(map[string]interface{})
+}
+
+func getCrawler(rootUrl string) WebCrawler {
+	crawler := WebCrawler{
+		Parser:  &UrlParser{},
+		RootUrl: rootUrl,
+	}
+
+	return crawler
+}
+
+func TestCrawlWithTimeout(t *testing.T) {
+	// The slow page only finishes once its request is cancelled, so the crawl
+	// can't return before the timeout
+	release := make(chan struct{})
+	slowStarted := make(chan struct{}, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/fast"></a><a href="/slow"></a>`))
+		case "/fast":
+			w.Write([]byte(`<p>Fast</p>`))
+		default:
+			slowStarted <- struct{}{}
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.CrawlWithTimeout("/", time.Second)
+
+	assert.Equal(t, ErrCrawlTimeout, err, "Didn't get a timeout error")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "Timeout error doesn't wrap the context's")
+	assert.Len(t, slowStarted, 1, "Slow page wasn't in flight at the timeout")
+	<-slowStarted
+	if assert.NotNil(t, result, "Didn't get a partial result") {
+		assert.Contains(t, result.Root.Children, fmt.Sprint(ts.URL, "/fast"), "Partial result is missing pages")
+		assert.NotContains(t, result.Root.Children, fmt.Sprint(ts.URL, "/slow"), "Slow page was crawled")
+	}
+
+	_, err = crawler.CrawlWithTimeout("/slow", 100*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrCrawlTimeout), "Didn't get a timeout error for the seed: %v", err)
+
+	result, err = crawler.CrawlWithTimeout("/fast", time.Minute)
+	assert.Nil(t, err, "Got an error from a crawl within the timeout")
+	assert.NotNil(t, result, "Didn't get a result")
+}
+
+func TestCrawlIdleTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/fast"></a><a href="/hang/1"></a><a href="/hang/2"></a>`))
+		case "/fast":
+			w.Write([]byte(`<p>Fast</p>`))
+		default:
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.IdleTimeout = 500 * time.Millisecond
+	start := time.Now()
+	result, err := crawler.Run("/")
+
+	assert.Equal(t, ErrIdleTimeout, err, "Didn't get an idle timeout error")
+	assert.Less(t, time.Since(start), 3*time.Second, "Crawl didn't stop when it stalled")
+	if assert.NotNil(t, result, "Didn't get a partial result") {
+		assert.Contains(t, result.Root.Children, fmt.Sprint(ts.URL, "/fast"), "Partial result is missing pages")
+		assert.Contains(t, result.DeadLinks, fmt.Sprint(ts.URL, "/hang/1"), "Stalled page wasn't recorded as dead")
+	}
+}
+
+func TestCrawlIdleTimeoutAllowsSlowProgress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if n < 4 {
+			fmt.Fprintf(w, `<a href="/%d">`, n+1)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.IdleTimeout = 500 * time.Millisecond
+	result, err := crawler.Run("/0")
+
+	assert.Nil(t, err, "Crawl making progress was stopped")
+	if assert.NotNil(t, result, "Didn't get a result") {
+		assert.Len(t, result.URLs(), 5, "Didn't crawl every page")
+	}
+}
+
+func TestCrawlIdleTimeoutKeepsOneWait(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	crawler := getCrawler(ts.URL)
+	crawler.Clock = clock
+	crawler.IdleTimeout = time.Minute
+	result, err := crawler.Run("/three/1.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Len(t, result.URLs(), 3, "Didn't crawl every page")
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	assert.LessOrEqual(t, len(clock.waiters), 1, "Waits for the idle timeout piled up")
+}
+
+func TestCrawlRecordsLinkScope(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.RecordLinkScope = true
+	root := crawlToPage(t, crawler, "/hosts.html")
+
+	assert.Equal(t, []ScopedLink{
+		{Url: "http://google.com", Internal: false},
+		{Url: "//google.com/search", Internal: false},
+		{Url: "https://EXAMPLE.org/", Internal: false},
+		{Url: fmt.Sprint(ts.URL, "/three/3.html"), Internal: true},
+	}, root.ScopedLinks, "Links weren't flagged by scope")
+	assert.Len(t, root.Links, 4, "Plain links changed")
+
+	three := root.Children[fmt.Sprint(ts.URL, "/three/3.html")]
+	if assert.NotNil(t, three, "Internal link wasn't crawled") {
+		assert.Nil(t, three.ScopedLinks, "Page without links has scoped links")
+	}
+}
+
+func TestCrawlMaxQueryVariants(t *testing.T) {
+	var mu sync.Mutex
+	var dates []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/calendar"></a><a href="/events?page=2"></a>`))
+		case "/calendar":
+			// Every day links to the next, forever
+			date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+			if err != nil {
+				date = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			} else {
+				mu.Lock()
+				dates = append(dates, r.URL.Query().Get("date"))
+				mu.Unlock()
+			}
+			fmt.Fprintf(w, `<a href="/calendar?date=%s">`, date.AddDate(0, 0, 1).Format("2006-01-02"))
+			fmt.Fprintf(w, `<a href="/calendar?date=%s&view=week">`, date.Format("2006-01-02"))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxQueryVariants = 5
+	crawler.FetchLimit = 100
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Len(t, dates, 5, "Didn't stop following calendar links")
+	assert.Contains(t, result.Root.Children, fmt.Sprint(ts.URL, "/calendar"), "Path without a query wasn't crawled")
+	assert.Contains(t, result.Root.Children, fmt.Sprint(ts.URL, "/events?page=2"), "Another path's variant wasn't crawled")
+}
+
+func TestCrawlDedupByPathOnly(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		if r.URL.Path == "/" {
+			for i := 1; i <= 20; i++ {
+				fmt.Fprintf(w, `<a href="/list?page=%d">`, i)
+			}
+			fmt.Fprint(w, `<a href="/list"><a href="/other?sort=asc">`)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.DedupByPathOnly = true
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]int{"/": 1, "/list": 1, "/other": 1}, requests, "Fetched a path more than once")
+
+	first := fmt.Sprint(ts.URL, "/list?page=1")
+	assert.Contains(t, result.Root.Children, first, "First variant wasn't crawled")
+	assert.Len(t, result.CollapsedQueries, 1, "Recorded paths without collapsed variants")
+	assert.Len(t, result.CollapsedQueries[first], 20, "Didn't record every collapsed variant")
+	assert.Contains(t, result.CollapsedQueries[first], fmt.Sprint(ts.URL, "/list"), "Didn't record the path without a query")
 }
@@ -0,0 +1,151 @@
+package gowebcrawler
+
+import (
+	"context"
+	"github.com/PuerkitoBio/goquery"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// How many levels of @import are followed from a page's stylesheets
+const maxCSSImportDepth = 5
+
+var (
+	cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssImport  = regexp.MustCompile(`@import\s+(?:url\(\s*)?["']?([^"'()\s;]+)`)
+	cssUrl     = regexp.MustCompile(`url\(\s*["']?([^"')]+?)["']?\s*\)`)
+)
+
+// Gets the URLs of <link rel="stylesheet"> elements in a goquery.Document,
+// resolved against base
+func GetStylesheetsFromDocument(doc *goquery.Document, base string) []string {
+	return doc.Find("link[rel~='stylesheet'][href]").Map(func(_ int, s *goquery.Selection) string {
+		href, _ := s.Attr("href")
+		return resolveUrl(base, strings.TrimSpace(href))
+	})
+}
+
+// ParseCSSReferences gets the stylesheets a piece of CSS pulls in with
+// @import and the other URLs it references with url(), as written. Data
+// URIs and references to fragments in the same document are skipped.
+func ParseCSSReferences(css string) (imports []string, urls []string) {
+	css = cssComment.ReplaceAllString(css, "")
+
+	imported := make(map[string]bool)
+	for _, m := range cssImport.FindAllStringSubmatch(css, -1) {
+		if ref := strings.TrimSpace(m[1]); isExternalCSSRef(ref) && !imported[ref] {
+			imported[ref] = true
+			imports = append(imports, ref)
+		}
+	}
+
+	for _, m := range cssUrl.FindAllStringSubmatch(css, -1) {
+		if ref := strings.TrimSpace(m[1]); isExternalCSSRef(ref) && !imported[ref] {
+			urls = append(urls, ref)
+		}
+	}
+	return imports, urls
+}
+
+// Checks that a CSS reference points at another resource
+func isExternalCSSRef(ref string) bool {
+	return ref != "" && !strings.HasPrefix(ref, "#") && !strings.HasPrefix(strings.ToLower(ref), "data:")
+}
+
+// Adds references in a page's inline <style> elements to its assets, and
+// notes any stylesheets they import to be fetched
+func parseInlineCSS(page *Page, doc *goquery.Document, base string) {
+	doc.Find("style").Each(func(_ int, s *goquery.Selection) {
+		imports, urls := ParseCSSReferences(s.Text())
+		for _, ref := range imports {
+			page.Assets = append(page.Assets, ref)
+			page.stylesheets = append(page.stylesheets, resolveUrl(base, ref))
+		}
+		for _, ref := range urls {
+			page.Assets = append(page.Assets, ref)
+		}
+	})
+}
+
+// Fetches a page's stylesheets and adds the assets they reference to its
+// assets, resolved against each stylesheet's URL, counting the requests and
+// bytes it took. Imported stylesheets are assets too, and are fetched in
+// turn. Stylesheets that are out of scope or can't be fetched are skipped.
+func (u UrlParser) addCSSAssets(ctx context.Context, page *Page) {
+	stylesheets := page.stylesheets
+	page.stylesheets = nil
+
+	seen := make(map[string]bool)
+	for _, sheet := range stylesheets {
+		seen[sheet] = true
+	}
+
+	for depth := 0; len(stylesheets) > 0 && depth < maxCSSImportDepth; depth++ {
+		var imported []string
+		for _, sheet := range stylesheets {
+			if !u.fetchableCSS(sheet) {
+				continue
+			}
+
+			css, err := u.fetchCSS(ctx, sheet)
+			page.cssRequests++
+			page.cssBytes += int64(len(css))
+			if err != nil {
+				continue
+			}
+
+			imports, urls := ParseCSSReferences(css)
+			for _, ref := range imports {
+				if ref = resolveUrl(sheet, ref); !seen[ref] {
+					seen[ref] = true
+					page.Assets = append(page.Assets, ref)
+					imported = append(imported, ref)
+				}
+			}
+			for _, ref := range urls {
+				if ref = resolveUrl(sheet, ref); !seen[ref] {
+					seen[ref] = true
+					page.Assets = append(page.Assets, ref)
+				}
+			}
+		}
+		stylesheets = imported
+	}
+}
+
+// Checks a stylesheet is http(s), and within the crawl's allowed domain
+// when the parser is crawling
+func (u UrlParser) fetchableCSS(sheet string) bool {
+	if u.cssScope != nil {
+		return u.cssScope(sheet) == nil
+	}
+	return hasAllowedScheme(sheet)
+}
+
+// Gets the contents of a stylesheet
+func (u UrlParser) fetchCSS(ctx context.Context, sheet string) (string, error) {
+	if !hasAllowedScheme(sheet) {
+		return "", ErrUnsupportedScheme
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", sheet, nil)
+	if err != nil {
+		return "", err
+	}
+	u.setUserAgent(req)
+
+	res, err := u.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if !u.acceptsStatus(res.StatusCode) {
+		return "", &StatusError{Code: res.StatusCode, Url: sheet}
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	return string(body), err
+}
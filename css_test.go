@@ -0,0 +1,100 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCSSReferences(t *testing.T) {
+	css := `
+		@import "reset.css";
+		@import url('theme.css') screen;
+		/* url(commented.png) */
+		body { background: url( "img/bg.png" ); }
+		.a { background: url(data:image/png;base64,AAAA); }
+		.b { fill: url(#shape); }
+		.c { cursor: url(/cursors/hand.cur), auto; }
+	`
+
+	imports, urls := ParseCSSReferences(css)
+	assert.Equal(t, []string{"reset.css", "theme.css"}, imports, "Wrong imports")
+	assert.Equal(t, []string{"img/bg.png", "/cursors/hand.cur"}, urls, "Wrong url() references")
+}
+
+func TestParsePageCSSAssets(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	parser := UrlParser{ParseCSSAssets: true}
+	page, err := parser.ParsePage(ts.URL + "/css/page.html")
+	assert.Nil(t, err, "Got an error from ParsePage")
+
+	expected := []string{
+		"/css/main.css",
+		"/css/logo.png",
+		"/css/inline.png",
+		ts.URL + "/css/fonts.css",
+		ts.URL + "/static/bg.png",
+		ts.URL + "/css/fonts/example.woff2",
+	}
+	assert.Equal(t, expected, page.Assets, "CSS assets weren't discovered")
+
+	// The page and each stylesheet once, despite fonts.css importing main.css
+	assert.Equal(t, 3, *requestCount, "Stylesheets weren't fetched once each")
+}
+
+func TestParsePageIgnoresCSSByDefault(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	page, err := UrlParser{}.ParsePage(ts.URL + "/css/page.html")
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Equal(t, []string{"/css/main.css", "/css/logo.png"}, page.Assets, "Found CSS assets without ParseCSSAssets")
+	assert.Equal(t, 1, *requestCount, "Fetched stylesheets without ParseCSSAssets")
+}
+
+func TestCrawlCSSAssetsStayInScope(t *testing.T) {
+	offDomain := 0
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offDomain++
+		w.Write([]byte(`body { background: url(/far.png); }`))
+	}))
+	defer other.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<link rel="stylesheet" href="/site.css"><link rel="stylesheet" href="%s/other.css"><a href="/next"></a>`, other.URL)
+		case "/site.css":
+			w.Write([]byte(strings.Repeat(" ", 1000) + `body { background: url(/near.png); }`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.ParseCSSAssets = true
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 0, offDomain, "Fetched a stylesheet off the allowed domain")
+	assert.Contains(t, result.Root.Assets, fmt.Sprint(ts.URL, "/near.png"), "Didn't find the stylesheet's assets")
+	assert.Equal(t, 3, result.Attempts, "Stylesheet fetch wasn't counted as an attempt")
+
+	// The stylesheet alone takes the crawl past the byte limit
+	crawler.MaxTotalBytes = 1000
+	result, err = crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Len(t, result.Root.Children, 0, "Stylesheet bytes weren't counted towards MaxTotalBytes")
+
+	crawler.MaxTotalBytes = 0
+	crawler.FetchLimit = 2
+	result, err = crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Len(t, result.Root.Children, 0, "Stylesheet fetch wasn't counted towards FetchLimit")
+}
@@ -0,0 +1,131 @@
+package gowebcrawler
+
+import (
+	"sort"
+)
+
+// A CrawlDiff is what changed on a site between two crawls of it, see Diff
+type CrawlDiff struct {
+	// Sorted URLs of pages only fetched in the new crawl, and of pages only
+	// fetched in the old one
+	Added   []string
+	Removed []string
+
+	// Pages fetched in both crawls whose content, links or assets changed,
+	// sorted by URL
+	Changed []PageChange
+}
+
+// A PageChange is how a page changed between two crawls
+type PageChange struct {
+	Url string
+
+	// Whether the page's ContentHash changed
+	ContentChanged bool `json:",omitempty"`
+
+	// Sorted absolute URLs of the links and assets the page gained and lost
+	AddedLinks    []string `json:",omitempty"`
+	RemovedLinks  []string `json:",omitempty"`
+	AddedAssets   []string `json:",omitempty"`
+	RemovedAssets []string `json:",omitempty"`
+}
+
+// Diff compares an old and a new crawl of a site, for spotting changes
+// between runs. Only pages that were fetched successfully are compared, so
+// a page that fails in the new crawl counts as removed. Links and assets are
+// compared as absolute URLs, ignoring order and repeats. Either result may
+// be nil, which is treated as a crawl that found nothing.
+func Diff(old, new *CrawlResult) *CrawlDiff {
+	before, after := fetchedPages(old), fetchedPages(new)
+	diff := &CrawlDiff{}
+
+	for u, p := range after {
+		o, ok := before[u]
+		if !ok {
+			diff.Added = append(diff.Added, u)
+			continue
+		}
+		if change, changed := diffPage(o, p); changed {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for u := range before {
+		if _, ok := after[u]; !ok {
+			diff.Removed = append(diff.Removed, u)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Url < diff.Changed[j].Url })
+	return diff
+}
+
+// Gets the pages of a crawl that were fetched successfully, by URL
+func fetchedPages(r *CrawlResult) map[string]*Page {
+	pages := make(map[string]*Page)
+	if r == nil || r.Root == nil {
+		return pages
+	}
+	for _, p := range r.Root.Flatten() {
+		if p.Error == "" {
+			pages[p.Url] = p
+		}
+	}
+	return pages
+}
+
+// Compares two crawls of a page, returning what changed and whether anything did
+func diffPage(old, new *Page) (PageChange, bool) {
+	change := PageChange{
+		Url:            new.Url,
+		ContentChanged: old.ContentHash != "" && new.ContentHash != "" && old.ContentHash != new.ContentHash,
+	}
+
+	oldLinks, newLinks := make([]string, len(old.Links)), make([]string, len(new.Links))
+	for i, l := range old.Links {
+		oldLinks[i] = resolveUrl(old.Url, l)
+	}
+	for i, l := range new.Links {
+		newLinks[i] = resolveUrl(new.Url, l)
+	}
+	change.AddedLinks, change.RemovedLinks = diffStrings(oldLinks, newLinks)
+
+	oldAssets, newAssets := make([]string, len(old.Assets)), make([]string, len(new.Assets))
+	for i, a := range old.Assets {
+		oldAssets[i] = normalizeAsset(old.Url, a)
+	}
+	for i, a := range new.Assets {
+		newAssets[i] = normalizeAsset(new.Url, a)
+	}
+	change.AddedAssets, change.RemovedAssets = diffStrings(oldAssets, newAssets)
+
+	changed := change.ContentChanged || len(change.AddedLinks) > 0 || len(change.RemovedLinks) > 0 ||
+		len(change.AddedAssets) > 0 || len(change.RemovedAssets) > 0
+	return change, changed
+}
+
+// Gets the sorted strings only in b and only in a, ignoring repeats
+func diffStrings(a, b []string) (added []string, removed []string) {
+	inA, inB := make(map[string]bool), make(map[string]bool)
+	for _, s := range a {
+		inA[s] = true
+	}
+	for _, s := range b {
+		inB[s] = true
+	}
+
+	for s := range inB {
+		if !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for s := range inA {
+		if !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,79 @@
+package gowebcrawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	version := 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			if version == 1 {
+				w.Write([]byte(`<a href="/a"><a href="/b"><a href="/old">`))
+			} else {
+				w.Write([]byte(`<a href="/a"><a href="/b"><a href="/new">`))
+			}
+		case "/a":
+			fmt.Fprintf(w, `<h1>Version %d</h1><img src="/v%d.png">`, version, version)
+		case "/b", "/old", "/new":
+			w.Write([]byte(`<p>Unchanged</p>`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	old, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from the first crawl")
+
+	version = 2
+	current, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from the second crawl")
+
+	diff := Diff(old, current)
+	assert.Equal(t, []string{fmt.Sprint(ts.URL, "/new")}, diff.Added, "Wrong added pages")
+	assert.Equal(t, []string{fmt.Sprint(ts.URL, "/old")}, diff.Removed, "Wrong removed pages")
+	assert.Equal(t, []PageChange{
+		{
+			Url:            fmt.Sprint(ts.URL, "/"),
+			ContentChanged: true,
+			AddedLinks:     []string{fmt.Sprint(ts.URL, "/new")},
+			RemovedLinks:   []string{fmt.Sprint(ts.URL, "/old")},
+		},
+		{
+			Url:            fmt.Sprint(ts.URL, "/a"),
+			ContentChanged: true,
+			AddedAssets:    []string{fmt.Sprint(ts.URL, "/v2.png")},
+			RemovedAssets:  []string{fmt.Sprint(ts.URL, "/v1.png")},
+		},
+	}, diff.Changed, "Wrong changed pages")
+
+	j, err := json.Marshal(diff)
+	assert.Nil(t, err, "Couldn't marshal the diff")
+	var decoded CrawlDiff
+	assert.Nil(t, json.Unmarshal(j, &decoded), "Couldn't unmarshal the diff")
+	assert.Equal(t, *diff, decoded, "Diff didn't survive a round trip through JSON")
+
+	assert.Empty(t, Diff(current, current).Changed, "Found changes comparing a crawl with itself")
+	assert.Len(t, Diff(nil, current).Added, 4, "Didn't add every page to an empty crawl")
+}
+
+func TestDiffIgnoresFailedPages(t *testing.T) {
+	old := &CrawlResult{Root: &Page{Url: "/a", Children: map[string]*Page{
+		"/b": {Url: "/b", ContentHash: "1", Children: map[string]*Page{}},
+	}}}
+	current := &CrawlResult{Root: &Page{Url: "/a", Children: map[string]*Page{
+		"/b": {Url: "/b", Error: "500", Children: map[string]*Page{}},
+		"/c": {Url: "/c", Error: "404", Children: map[string]*Page{}},
+	}}}
+
+	diff := Diff(old, current)
+	assert.Empty(t, diff.Added, "Added a page that failed")
+	assert.Equal(t, []string{"/b"}, diff.Removed, "Page that started failing wasn't removed")
+	assert.Empty(t, diff.Changed, "Found changes without any")
+}
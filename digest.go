@@ -0,0 +1,234 @@
+package gowebcrawler
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A digestTransport answers HTTP Digest auth challenges (RFC 7616) with a
+// username and password. Once a host has sent a challenge, later requests
+// to it are authorized up front instead of waiting for another 401.
+type digestTransport struct {
+	base     http.RoundTripper
+	username string
+	password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// A Digest challenge from a WWW-Authenticate header, and how many times
+// its nonce has been used
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+	count     int
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.send(req, t.challenge(req.URL.Host))
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// Try again with a new challenge, twice if the first answer's nonce had gone stale
+	for tries := 0; tries < 2; tries++ {
+		c := parseDigestChallenge(res.Header.Values("WWW-Authenticate"))
+		if c == nil || (tries > 0 && !c.stale) {
+			return res, nil
+		}
+
+		// A body that's been sent can't be sent again
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return res, nil
+		}
+		res.Body.Close()
+
+		t.mu.Lock()
+		if t.challenges == nil {
+			t.challenges = make(map[string]*digestChallenge)
+		}
+		t.challenges[req.URL.Host] = c
+		t.mu.Unlock()
+
+		if req.GetBody != nil {
+			req = req.Clone(req.Context())
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		if res, err = t.send(req, c); err != nil || res.StatusCode != http.StatusUnauthorized {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Gets the last challenge from a host, nil if there hasn't been one
+func (t *digestTransport) challenge(host string) *digestChallenge {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.challenges[host]
+}
+
+// Sends a copy of a request, answering the challenge if there is one
+func (t *digestTransport) send(req *http.Request, c *digestChallenge) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if c == nil {
+		return base.RoundTrip(req)
+	}
+
+	t.mu.Lock()
+	c.count++
+	count := c.count
+	t.mu.Unlock()
+
+	auth, err := c.authorization(t.username, t.password, req.Method, req.URL.RequestURI(), count, newCnonce())
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", auth)
+	return base.RoundTrip(r)
+}
+
+// Gets the first Digest challenge from WWW-Authenticate header values, nil
+// if there isn't one
+func parseDigestChallenge(headers []string) *digestChallenge {
+	for _, h := range headers {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(h), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+
+		p := parseAuthParams(params)
+		c := &digestChallenge{
+			realm:     p["realm"],
+			nonce:     p["nonce"],
+			opaque:    p["opaque"],
+			algorithm: p["algorithm"],
+			stale:     strings.EqualFold(p["stale"], "true"),
+		}
+
+		// Only auth is supported, as auth-int needs the whole body hashed
+		for _, q := range strings.Split(p["qop"], ",") {
+			if strings.TrimSpace(q) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if c.nonce == "" || (p["qop"] != "" && c.qop == "") {
+			continue
+		}
+		return c
+	}
+	return nil
+}
+
+// Parses comma separated key=value pairs from an auth header, where values
+// may be quoted strings containing commas
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value = b.String()
+			if s = ""; i+1 < len(rest) {
+				s = rest[i+1:]
+			}
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+	}
+}
+
+// Builds the Authorization header answering a challenge for the count'th
+// request using its nonce
+func (c *digestChallenge) authorization(username, password, method, uri string, count int, cnonce string) (string, error) {
+	algorithm := strings.ToUpper(c.algorithm)
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("Unsupported Digest auth algorithm: %s", c.algorithm)
+	}
+	h := func(s string) string {
+		d := newHash()
+		d.Write([]byte(s))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	nc := fmt.Sprintf("%08x", count)
+	ha1 := h(username + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	var response string
+	if c.qop != "" {
+		response = h(strings.Join([]string{ha1, c.nonce, nc, cnonce, c.qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	parts := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}
+	if c.algorithm != "" {
+		parts = append(parts, "algorithm="+c.algorithm)
+	}
+	if c.opaque != "" {
+		parts = append(parts, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	if c.qop != "" {
+		parts = append(parts, "qop="+c.qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	return "Digest " + strings.Join(parts, ", "), nil
+}
+
+// Gets a random client nonce
+func newCnonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,87 @@
+package gowebcrawler
+
+import (
+	"crypto/md5"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// Examples from RFC 2617 section 3.5 and RFC 7616 section 3.9.1
+	c := parseDigestChallenge([]string{
+		`Basic realm="other"`,
+		`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+	})
+	if assert.NotNil(t, c, "Didn't find the Digest challenge") {
+		auth, err := c.authorization("Mufasa", "Circle Of Life", "GET", "/dir/index.html", 1, "0a4f113b")
+		assert.Nil(t, err, "Got an error from authorization")
+		assert.Contains(t, auth, `response="6629fae49393a05397450978507c4ef1"`, "Wrong MD5 response")
+		assert.Contains(t, auth, `opaque="5ccc069c403ebaf9f0171e9517f40e41"`, "Didn't send the opaque value back")
+		assert.Contains(t, auth, "nc=00000001", "Wrong nonce count")
+	}
+
+	for algorithm, expected := range map[string]string{
+		"MD5":     "8ca523f5e9506fed4657c9700eebdbec",
+		"SHA-256": "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	} {
+		c := parseDigestChallenge([]string{fmt.Sprintf(
+			`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			algorithm,
+		)})
+		auth, err := c.authorization("Mufasa", "Circle of Life", "GET", "/dir/index.html", 1, "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+		assert.Nil(t, err, "Got an error from authorization")
+		assert.Contains(t, auth, fmt.Sprintf(`response="%s"`, expected), "Wrong %s response", algorithm)
+	}
+
+	c = parseDigestChallenge([]string{`Digest realm="r", nonce="n", algorithm=SHA-512-256`})
+	_, err := c.authorization("user", "pass", "GET", "/", 1, "c")
+	assert.NotNil(t, err, "Didn't reject an unsupported algorithm")
+}
+
+func TestCrawlDigestAuth(t *testing.T) {
+	const realm, nonce = "crawler@example.com", "abc123"
+	h := func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+
+	var mu sync.Mutex
+	challenges := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := parseAuthParams(strings.TrimPrefix(r.Header.Get("Authorization"), "Digest "))
+		ha1 := h("user:" + realm + ":secret")
+		ha2 := h(r.Method + ":" + p["uri"])
+		expected := h(ha1 + ":" + nonce + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+
+		if p["username"] != "user" || p["uri"] != r.URL.RequestURI() || p["response"] != expected {
+			mu.Lock()
+			challenges++
+			mu.Unlock()
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth", nonce="%s"`, realm, nonce))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/private.html">`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	_, err := crawler.Run("/")
+	assert.NotNil(t, err, "Crawled without credentials")
+
+	challenges = 0
+	crawler.DigestUsername = "user"
+	crawler.DigestPassword = "secret"
+	result, err := crawler.Run("/")
+
+	if !assert.Nil(t, err, "Got an error from Run") {
+		return
+	}
+	assert.Contains(t, result.Root.Children, fmt.Sprint(ts.URL, "/private.html"), "Protected page wasn't crawled")
+	assert.Equal(t, 1, challenges, "Later requests weren't authorized up front")
+}
@@ -0,0 +1,42 @@
+package gowebcrawler
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// An ErrorLogEntry is one line of WebCrawler.ErrorLog
+type ErrorLogEntry struct {
+	Url   string    `json:"url"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// Writes failed fetches to a writer as JSON Lines, one write per failure
+// so concurrent fetches never interleave
+type errorLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// Gets an errorLog writing to w, nil if w is nil
+func newErrorLog(w io.Writer) *errorLog {
+	if w == nil {
+		return nil
+	}
+	return &errorLog{enc: json.NewEncoder(w)}
+}
+
+// Writes an entry for a failed fetch of url. Does nothing when there's no
+// error or no log. Write errors are ignored so a broken log can't stop the crawl.
+func (l *errorLog) record(url string, err error, at time.Time) {
+	if l == nil || err == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(ErrorLogEntry{Url: url, Error: err.Error(), Time: at})
+}
@@ -0,0 +1,57 @@
+package gowebcrawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCrawlWritesErrorLog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/ok"></a><a href="/missing"></a><a href="/broken"></a>` +
+				`<a href="http://google.example/x"></a><a href="mailto:a@b.c"></a>`))
+		case "/ok":
+			w.Write([]byte(`<p>Fine</p>`))
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var log bytes.Buffer
+	crawler := getCrawler(ts.URL)
+	crawler.ErrorLog = &log
+	crawler.Clock = NewFakeClock(now)
+	crawler.MaxRetries = 1
+
+	_, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+
+	var entries []ErrorLogEntry
+	scanner := bufio.NewScanner(&log)
+	for scanner.Scan() {
+		var entry ErrorLogEntry
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &entry), "Line isn't JSON: %s", scanner.Text())
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Url < entries[j].Url })
+
+	broken, missing := fmt.Sprint(ts.URL, "/broken"), fmt.Sprint(ts.URL, "/missing")
+	assert.Equal(t, []ErrorLogEntry{
+		{Url: broken, Error: (&StatusError{Code: 500, Url: broken}).Error(), Time: now},
+		{Url: broken, Error: (&StatusError{Code: 500, Url: broken}).Error(), Time: now},
+		{Url: missing, Error: (&StatusError{Code: 404, Url: missing}).Error(), Time: now},
+	}, entries, "Didn't log each failed fetch, including the retry, and nothing else")
+}
@@ -1,18 +1,33 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/cgenuity/gowebcrawler"
+	"os"
+	"strings"
 )
 
 func main() {
 	var (
 		rootUrl  = flag.String("rootUrl", "https://www.golang.org", "Root Url for crawling")
 		rootPath = flag.String("path", "/", "Path after Root Url to start the crawl")
+		seedFile = flag.String("seedFile", "", "File of paths or URLs to crawl, one per line, used instead of -path. "+
+			"Prints one JSON object mapping each seed to its site map.")
 	)
 	flag.Parse()
 
+	seeds := []string{*rootPath}
+	if *seedFile != "" {
+		var err error
+		if seeds, err = readSeeds(*seedFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Seed file error: ", err)
+			os.Exit(1)
+		}
+	}
+
 	parser := gowebcrawler.UrlParser{}
 
 	crawler := gowebcrawler.WebCrawler{
@@ -21,10 +36,69 @@ func main() {
 		FetchLimit: 50,
 	}
 
-	json, err := crawler.Crawl(*rootPath)
+	// Errors go to stderr so the output stays a single JSON document
+	failed := false
+	siteMaps := make(map[string]*gowebcrawler.Page)
+	for _, seed := range seeds {
+		result, err := crawler.Run(seed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Crawl error: ", err)
+			failed = true
+			continue
+		}
+		siteMaps[seed] = result.Root
+
+		// Report failures so the exit code can be used as a CI check
+		ok, failures := result.Summary()
+		for _, f := range failures {
+			fmt.Fprintln(os.Stderr, "Failed:", f)
+		}
+		failed = failed || !ok
+	}
+
+	var err error
+	if *seedFile != "" {
+		err = printJSON(siteMaps)
+	} else if root := siteMaps[*rootPath]; root != nil {
+		err = printJSON(root)
+	}
 	if err != nil {
-		fmt.Println("Crawl error: ", err)
-	} else {
-		fmt.Println(string(json))
+		fmt.Fprintln(os.Stderr, "Crawl error: ", err)
+		failed = true
+	}
+
+	if failed {
+		os.Exit(1)
 	}
 }
+
+// Prints a value as indented JSON
+func printJSON(v interface{}) error {
+	j, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(j))
+	return nil
+}
+
+// Reads seeds from a file, skipping blank lines and "#" comments
+func readSeeds(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+
+	return seeds, scanner.Err()
+}
@@ -0,0 +1,245 @@
+package gowebcrawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Gets <link rel="alternate" hreflang="..."> entries from a goquery.Document
+// as a map of language to URL, resolved against base
+func GetAlternatesFromDocument(doc *goquery.Document, base string) map[string]string {
+	var alternates map[string]string
+	doc.Find("link[rel~='alternate'][hreflang][href]").Each(func(_ int, s *goquery.Selection) {
+		lang, _ := s.Attr("hreflang")
+		href, _ := s.Attr("href")
+		lang = strings.TrimSpace(lang)
+		if lang == "" || strings.TrimSpace(href) == "" {
+			return
+		}
+
+		if alternates == nil {
+			alternates = make(map[string]string)
+		}
+		alternates[lang] = resolveUrl(base, strings.TrimSpace(href))
+	})
+	return alternates
+}
+
+// Gets the target of a <link rel="canonical"> in a goquery.Document resolved
+// against base, empty if there isn't one
+func GetCanonicalFromDocument(doc *goquery.Document, base string) string {
+	href, _ := doc.Find("link[rel~='canonical'][href]").First().Attr("href")
+	if href = strings.TrimSpace(href); href == "" {
+		return ""
+	}
+	return resolveUrl(base, href)
+}
+
+// Gets the next and previous pages of a paginated listing from
+// <link rel="next"> and <link rel="prev"> (or <a> with the same rel)
+// in a goquery.Document, resolved against base
+func GetPaginationFromDocument(doc *goquery.Document, base string) (next string, prev string) {
+	find := func(rel string) string {
+		selector := fmt.Sprintf("link[rel~='%s'][href], a[rel~='%s'][href]", rel, rel)
+		href, _ := doc.Find(selector).First().Attr("href")
+		if href = strings.TrimSpace(href); href == "" {
+			return ""
+		}
+		return resolveUrl(base, href)
+	}
+
+	prev = find("prev")
+	if prev == "" {
+		prev = find("previous")
+	}
+	return find("next"), prev
+}
+
+// Gets the directives from <meta name="robots"> elements in a goquery.Document,
+// lowercased, e.g. "noindex" and "nofollow"
+func GetMetaRobotsFromDocument(doc *goquery.Document) []string {
+	var directives []string
+	doc.Find("meta[name][content]").Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		if !strings.EqualFold(strings.TrimSpace(name), "robots") {
+			return
+		}
+		content, _ := s.Attr("content")
+		for _, d := range strings.Split(content, ",") {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				directives = append(directives, d)
+			}
+		}
+	})
+	return directives
+}
+
+// Open Graph and Twitter Card properties recorded by GetOpenGraphFromDocument
+var openGraphProperties = map[string]bool{
+	"og:title":     true,
+	"og:image":     true,
+	"og:url":       true,
+	"twitter:card": true,
+}
+
+// Gets the Open Graph and Twitter Card properties used for social previews
+// from <meta property> (or <meta name>) elements in a goquery.Document, by
+// property. og:image is resolved against base. The first of each is kept.
+func GetOpenGraphFromDocument(doc *goquery.Document, base string) map[string]string {
+	var og map[string]string
+	doc.Find("meta[content]").Each(func(_ int, s *goquery.Selection) {
+		property, ok := s.Attr("property")
+		if !ok {
+			property, _ = s.Attr("name")
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		content, _ := s.Attr("content")
+		content = strings.TrimSpace(content)
+		if content == "" || !openGraphProperties[property] || og[property] != "" {
+			return
+		}
+
+		if property == "og:image" {
+			content = resolveUrl(base, content)
+		}
+		if og == nil {
+			og = make(map[string]string)
+		}
+		og[property] = content
+	})
+	return og
+}
+
+// A Link is a link's URL along with its anchor text
+type Link struct {
+	Url  string
+	Text string
+}
+
+// Gets the same links as GetLinksFromDocument along with their visible
+// text, with whitespace collapsed. Links without text, such as image links,
+// fall back to their title or their image's alt text.
+func GetLinkTextFromDocument(doc *goquery.Document) []Link {
+	var links []Link
+	doc.Find("a[href]").Not("a[href='#']").Not("a[href='']").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		if text == "" {
+			text, _ = s.Attr("title")
+		}
+		if text == "" {
+			text, _ = s.Find("img[alt]").First().Attr("alt")
+		}
+		links = append(links, Link{Url: href, Text: strings.TrimSpace(text)})
+	})
+	return links
+}
+
+// Gets the links from image map <area href> elements in a goquery.Document
+func GetAreaLinksFromDocument(doc *goquery.Document) []string {
+	return doc.Find("area[href]").Not("area[href='#']").Not("area[href='']").
+		Map(func(_ int, s *goquery.Selection) string {
+			href, _ := s.Attr("href")
+			return href
+		})
+}
+
+// Gets the targets of GET forms in a goquery.Document. Forms without an
+// action submit to the page they're on, so they're skipped.
+func GetFormActionsFromDocument(doc *goquery.Document) []string {
+	var actions []string
+	doc.Find("form[action]").Not("form[action='']").Not("form[action='#']").
+		Each(func(_ int, s *goquery.Selection) {
+			method, _ := s.Attr("method")
+			if method = strings.TrimSpace(method); method != "" && !strings.EqualFold(method, "get") {
+				return
+			}
+			action, _ := s.Attr("action")
+			actions = append(actions, action)
+		})
+	return actions
+}
+
+// Gets the "url" and "@id" values in <script type="application/ld+json">
+// blocks of a goquery.Document that point to other pages on base's host,
+// resolved against base and without fragments. Blocks that aren't valid
+// JSON are skipped.
+func GetJSONLDLinksFromDocument(doc *goquery.Document, base string) []string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	seen := map[string]bool{b.String(): true}
+	doc.Find("script[type]").Each(func(_ int, s *goquery.Selection) {
+		t, _ := s.Attr("type")
+		if !strings.EqualFold(strings.TrimSpace(t), "application/ld+json") {
+			return
+		}
+
+		var data interface{}
+		if json.Unmarshal([]byte(s.Text()), &data) != nil {
+			return
+		}
+
+		for _, ref := range jsonLDUrls(data) {
+			u, err := b.Parse(strings.TrimSpace(ref))
+			if err != nil || !strings.EqualFold(u.Host, b.Host) {
+				continue
+			}
+			u.Fragment = ""
+			if link := u.String(); !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	})
+	return links
+}
+
+// Gets every string "url" and "@id" value in decoded JSON-LD, however deeply nested
+func jsonLDUrls(data interface{}) []string {
+	var urls []string
+	switch v := data.(type) {
+	case map[string]interface{}:
+		// In key order, so links come out the same way every time
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if key != "url" && key != "@id" {
+				urls = append(urls, jsonLDUrls(v[key])...)
+				continue
+			}
+
+			// A single URL or a list of them
+			switch value := v[key].(type) {
+			case string:
+				urls = append(urls, value)
+			case []interface{}:
+				for _, item := range value {
+					if s, ok := item.(string); ok {
+						urls = append(urls, s)
+					} else {
+						urls = append(urls, jsonLDUrls(item)...)
+					}
+				}
+			default:
+				urls = append(urls, jsonLDUrls(value)...)
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			urls = append(urls, jsonLDUrls(value)...)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,196 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCrawlFollowsAreaLinksAndFormActions(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := WebCrawler{
+		Parser:  &UrlParser{FollowAreaLinks: true, FollowFormActions: true},
+		RootUrl: ts.URL,
+	}
+
+	root := crawlToPage(t, crawler, "/image_map.html")
+
+	assert.Equal(t, []string{"/three/3.html", "/example.com.html", "/circular/3.html"}, root.Links, "Didn't find area and form links")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/three/3.html"), "Area target was not crawled")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/example.com.html"), "GET form target was not crawled")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/circular/3.html"), "Form without a method was not crawled")
+
+	root = crawlToPage(t, getCrawler(ts.URL), "/image_map.html")
+
+	assert.Nil(t, root.Links, "Found links when it shouldn't have.")
+}
+
+func TestCrawlRecordsAlternates(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	root := crawlToPage(t, getCrawler(ts.URL), "/hreflang.html")
+
+	expected := map[string]string{
+		"en":        fmt.Sprint(ts.URL, "/hreflang.html"),
+		"de":        fmt.Sprint(ts.URL, "/de/hreflang.html"),
+		"fr-CA":     "https://example.ca/fr/",
+		"x-default": fmt.Sprint(ts.URL, "/hreflang.html"),
+	}
+	assert.Equal(t, expected, root.Alternates, "Didn't record the alternates")
+	assert.Equal(t, 1, *requestCount, "Alternates were crawled")
+}
+
+func TestCrawlRespectsMetaRobots(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	root := crawlToPage(t, crawler, "/robots/start.html")
+
+	assert.Equal(t, []string{"noindex", "nofollow"}, root.Robots, "Didn't record the meta robots directives")
+	assert.False(t, root.NoIndex, "Flagged noindex without RespectMetaRobots")
+	assert.Len(t, root.Children, 1, "Didn't follow links by default")
+
+	*requestCount = 0
+	crawler.RespectMetaRobots = true
+	root = crawlToPage(t, crawler, "/robots/start.html")
+
+	assert.Equal(t, 1, *requestCount, "Followed links from a nofollow page")
+	assert.True(t, root.NoIndex, "Didn't flag a noindex page")
+	assert.Len(t, root.Children, 0, "Followed links from a nofollow page")
+}
+
+func TestCrawlFollowsCanonical(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	root := crawlToPage(t, crawler, "/canonical/page.html")
+	assert.Len(t, root.Children, 0, "Followed the canonical link by default")
+
+	*requestCount = 0
+	crawler.Parser.FollowCanonical = true
+	root = crawlToPage(t, crawler, "/canonical/page.html")
+
+	assert.Equal(t, 2, *requestCount, "Didn't make the right amount of requests")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/canonical/target.html"), "Canonical page was not crawled")
+}
+
+func TestCrawlIgnoresSelfCanonical(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.FollowCanonical = true
+	root := crawlToPage(t, crawler, "/canonical/target.html")
+
+	assert.Equal(t, 1, *requestCount, "Didn't make the right amount of requests")
+	assert.Empty(t, root.Links, "Page linked to itself through its canonical")
+}
+
+func TestCrawlFollowsPagination(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	root := crawlToPage(t, crawler, "/paged/1.html")
+	assert.Equal(t, fmt.Sprint(ts.URL, "/paged/2.html"), root.Next, "Didn't record the next page")
+	assert.Len(t, root.Children, 0, "Followed pagination by default")
+
+	*requestCount = 0
+	crawler.Parser.FollowPagination = true
+	root = crawlToPage(t, crawler, "/paged/1.html")
+
+	assert.Equal(t, 3, *requestCount, "Didn't make the right amount of requests")
+	two := root.Children[fmt.Sprint(ts.URL, "/paged/2.html")]
+	if assert.NotNil(t, two, "Second page was not crawled") {
+		assert.Equal(t, fmt.Sprint(ts.URL, "/paged/1.html"), two.Prev, "Didn't record the previous page")
+		three := two.Children[fmt.Sprint(ts.URL, "/paged/3.html")]
+		if assert.NotNil(t, three, "Third page was not crawled") {
+			assert.Equal(t, "", three.Next, "Last page has a next page")
+			assert.Equal(t, fmt.Sprint(ts.URL, "/paged/2.html"), three.Prev, "Didn't resolve the previous page")
+		}
+	}
+}
+
+func TestCrawlParsesJSONLD(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.ParseJSONLD = true
+	root := crawlToPage(t, crawler, "/jsonld/index.html")
+
+	assert.Equal(t, []string{
+		"/jsonld/index.html",
+		fmt.Sprint(ts.URL, "/jsonld/author.html"),
+		fmt.Sprint(ts.URL, "/jsonld/section.html"),
+	}, root.Links, "Didn't find the same host JSON-LD links")
+	assert.Len(t, root.Children, 2, "JSON-LD links weren't crawled")
+
+	crawler.Parser.ParseJSONLD = false
+	root = crawlToPage(t, crawler, "/jsonld/index.html")
+	assert.Equal(t, []string{"/jsonld/index.html"}, root.Links, "Parsed JSON-LD without ParseJSONLD")
+}
+
+func TestCrawlRecordsLinkText(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.FetchLimit = 1
+	root := crawlToPage(t, crawler, "/link_text.html")
+	assert.Nil(t, root.TextLinks, "Recorded link text by default")
+
+	crawler.Parser.RecordLinkText = true
+	root = crawlToPage(t, crawler, "/link_text.html")
+
+	assert.Equal(t, []Link{
+		{Url: "/", Text: "Home"},
+		{Url: "/about.html", Text: "About us"},
+		{Url: "/docs/guide.html", Text: "getting started guide"},
+		{Url: "/search.html", Text: "Search"},
+		{Url: "/gallery.html", Text: "Gallery"},
+	}, root.TextLinks, "Didn't capture the anchor text")
+	assert.Equal(t, []string{"/", "/about.html", "/docs/guide.html", "/search.html", "/gallery.html"}, root.Links, "Plain links changed")
+}
+
+func TestCrawlRecordsOpenGraph(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.FetchLimit = 1
+	root := crawlToPage(t, crawler, "/open_graph.html")
+	assert.Nil(t, root.OpenGraph, "Recorded Open Graph tags by default")
+
+	crawler.Parser.RecordOpenGraph = true
+	root = crawlToPage(t, crawler, "/open_graph.html")
+
+	assert.Equal(t, map[string]string{
+		"og:title":     "Spring sale",
+		"og:image":     fmt.Sprint(ts.URL, "/images/sale.png"),
+		"og:url":       "https://example.com/sale",
+		"twitter:card": "summary_large_image",
+	}, root.OpenGraph, "Didn't capture the Open Graph tags")
+}
+
+func TestCrawlRecordsFragments(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.RecordFragments = true
+	result, err := crawler.Run("/spa/index.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	root := result.Root
+	assert.Equal(t, []string{"#/", "#/products", "#/products?sort=price", "#top"}, root.Fragments, "Didn't record the fragments")
+	assert.Equal(t, []string{"/spa/help.html"}, root.Links, "Fragments were left in the links")
+	assert.Len(t, root.Children, 1, "Children length is not 1")
+	assert.Empty(t, result.DeadLinks, "Tried to fetch a fragment")
+	assert.Equal(t, 2, *requestCount, "Didn't make the right amount of requests")
+}
@@ -0,0 +1,80 @@
+package gowebcrawler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A HeaderLink is an entry from a response's HTTP Link header, such as
+// `<https://example.com/page/2>; rel="next"`
+type HeaderLink struct {
+	Url string
+
+	// Relation types, lowercased and separated by spaces, e.g. "next" or "preload"
+	Rel string `json:",omitempty"`
+}
+
+// Gets the entries of every Link header in a response, resolved against base
+func parseLinkHeaders(header http.Header, base string) []HeaderLink {
+	var links []HeaderLink
+	for _, value := range header.Values("Link") {
+		for _, entry := range splitUnquoted(value, ',') {
+			parts := splitUnquoted(entry, ';')
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			link := HeaderLink{Url: resolveUrl(base, strings.TrimSpace(target[1:len(target)-1]))}
+			for _, param := range parts[1:] {
+				key, val, _ := strings.Cut(param, "=")
+				if strings.EqualFold(strings.TrimSpace(key), "rel") {
+					val = strings.Trim(strings.TrimSpace(val), `"`)
+					link.Rel = strings.ToLower(strings.Join(strings.Fields(val), " "))
+				}
+			}
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// Splits s on sep, except where it's inside quotes or <>
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	quoted, bracketed, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"' && !bracketed:
+			quoted = !quoted
+		case c == '<' && !quoted:
+			bracketed = true
+		case c == '>' && !quoted:
+			bracketed = false
+		case c == sep && !quoted && !bracketed:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Gets the links with a rel="next" or rel="prev" relation that are on the
+// same host as base, for following pagination given in Link headers
+func headerPaginationLinks(links []HeaderLink, base string) []string {
+	var pages []string
+	for _, l := range links {
+		if hostOf(l.Url) != hostOf(base) {
+			continue
+		}
+		for _, rel := range strings.Fields(l.Rel) {
+			if rel == "next" || rel == "prev" || rel == "previous" {
+				pages = append(pages, l.Url)
+				break
+			}
+		}
+	}
+	return pages
+}
@@ -0,0 +1,65 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseLinkHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Add("Link", `</items?page=2&sort=a,b>; rel="next", <https://cdn.example.com/app.css>; rel=preload; as=style`)
+	header.Add("Link", `<../first>; title="First; oldest"; rel="First Prev"`)
+	header.Add("Link", `not a link, <>; rel=self`)
+
+	links := parseLinkHeaders(header, "https://example.com/api/items")
+	assert.Equal(t, []HeaderLink{
+		{Url: "https://example.com/items?page=2&sort=a,b", Rel: "next"},
+		{Url: "https://cdn.example.com/app.css", Rel: "preload"},
+		{Url: "https://example.com/first", Rel: "first prev"},
+		{Url: "https://example.com/api/items", Rel: "self"},
+	}, links, "Didn't parse the Link headers")
+
+	assert.Equal(t, []string{
+		"https://example.com/items?page=2&sort=a,b",
+		"https://example.com/first",
+	}, headerPaginationLinks(links, "https://example.com/api/items"), "Wrong pagination links")
+}
+
+func TestCrawlFollowsLinkHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/items/1":
+			w.Header().Add("Link", `</items/2>; rel="next", <http://other.example/items/2>; rel="next"`)
+			w.Header().Add("Link", `</style.css>; rel=preload; as=style`)
+		case "/items/2":
+			w.Header().Set("Link", `</items/1>; rel="prev"`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`<p>Items</p>`))
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	root := crawlToPage(t, crawler, "/items/1")
+
+	assert.Equal(t, []HeaderLink{
+		{Url: fmt.Sprint(ts.URL, "/items/2"), Rel: "next"},
+		{Url: "http://other.example/items/2", Rel: "next"},
+		{Url: fmt.Sprint(ts.URL, "/style.css"), Rel: "preload"},
+	}, root.LinkHeaders, "Didn't record the Link headers")
+	assert.Len(t, root.Children, 0, "Followed Link headers without FollowPagination")
+
+	crawler.Parser.FollowPagination = true
+	root = crawlToPage(t, crawler, "/items/1")
+
+	assert.Equal(t, []string{fmt.Sprint(ts.URL, "/items/2")}, root.Links, "Didn't follow the same host next link")
+	two := root.Children[fmt.Sprint(ts.URL, "/items/2")]
+	if assert.NotNil(t, two, "Next page was not crawled") {
+		assert.Equal(t, []string{fmt.Sprint(ts.URL, "/items/1")}, two.Links, "Didn't follow the prev link")
+	}
+}
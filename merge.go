@@ -0,0 +1,171 @@
+package gowebcrawler
+
+import (
+	"sort"
+)
+
+// Merge combines the results of several crawls, such as separate crawls of
+// different sections of a site, into one. Pages are deduplicated by URL,
+// keeping the richest record of each. The links between pages found in any
+// crawl are combined, and each page is placed once in the tree, under the
+// first page linking to it breadth-first from the merged root, so crawls
+// linking pages in opposite directions can't make a cycle. The first
+// result's root is the merged root, and the roots of the others are added
+// as its children unless they're already in the tree.
+// Stats, asset lists and traces are added together, the earliest crawl
+// time is kept, and dead links that were fetched fine in another crawl are
+// dropped. The results passed in aren't modified.
+func Merge(results ...*CrawlResult) *CrawlResult {
+	merged := &CrawlResult{
+		Hosts:     make(map[string]int),
+		DeadLinks: make(map[string]string),
+	}
+
+	best := make(map[string]*Page)
+	children := make(map[string][]string)
+	duplicates := make(map[string][]string)
+	assets := make(map[string][]string)
+	var roots []string
+
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+
+		if merged.CrawledAt.IsZero() || (!r.CrawledAt.IsZero() && r.CrawledAt.Before(merged.CrawledAt)) {
+			merged.CrawledAt = r.CrawledAt
+		}
+		merged.Attempts += r.Attempts
+		for host, n := range r.Hosts {
+			merged.Hosts[host] += n
+		}
+		for u, e := range r.DeadLinks {
+			merged.DeadLinks[u] = e
+		}
+		for u, status := range r.AssetStatus {
+			if merged.AssetStatus == nil {
+				merged.AssetStatus = make(map[string]int)
+			}
+			if old, ok := merged.AssetStatus[u]; !ok || old == 0 {
+				merged.AssetStatus[u] = status
+				if assetType, ok := r.AssetTypes[u]; ok {
+					if merged.AssetTypes == nil {
+						merged.AssetTypes = make(map[string]string)
+					}
+					merged.AssetTypes[u] = assetType
+				}
+			}
+		}
+		for hash, urls := range r.Duplicates {
+			duplicates[hash] = append(duplicates[hash], urls...)
+		}
+		merged.Trace = append(merged.Trace, r.Trace...)
+		for _, ref := range r.Assets {
+			assets[ref.Url] = append(assets[ref.Url], ref.Pages...)
+		}
+
+		if r.Root == nil {
+			continue
+		}
+		roots = append(roots, r.Root.Url)
+		for _, p := range r.Root.Flatten() {
+			if b, ok := best[p.Url]; !ok || richer(p, b) {
+				best[p.Url] = p
+			}
+			for _, c := range sortedChildren(p) {
+				children[p.Url] = append(children[p.Url], c.Url)
+			}
+		}
+	}
+
+	// Copy the chosen pages and link them up with every child seen
+	pages := make(map[string]*Page, len(best))
+	for u, p := range best {
+		c := *p
+		c.parent = nil
+		c.Children = make(map[string]*Page)
+		pages[u] = &c
+	}
+
+	// Crawls can link the same pages in different directions, so each page
+	// is placed once, under the first page found linking to it breadth-first
+	// from the root. Roots that aren't reached go under the merged root.
+	if len(roots) > 0 {
+		merged.Root = pages[roots[0]]
+		placed := map[string]bool{roots[0]: true}
+		queue := []string{roots[0]}
+		place := func(parent string, u string) {
+			if !placed[u] {
+				placed[u] = true
+				pages[parent].Children[u] = pages[u]
+				queue = append(queue, u)
+			}
+		}
+
+		for _, root := range roots {
+			place(roots[0], root)
+			for len(queue) > 0 {
+				u := queue[0]
+				queue = queue[1:]
+				for _, c := range children[u] {
+					place(u, c)
+				}
+			}
+		}
+	}
+
+	for u := range merged.DeadLinks {
+		if p, ok := pages[u]; ok && p.Error == "" {
+			delete(merged.DeadLinks, u)
+		}
+	}
+
+	for hash, urls := range duplicates {
+		merged.Duplicates = mergeDuplicates(merged.Duplicates, hash, urls)
+	}
+
+	if len(assets) > 0 {
+		collected := newAssetCollector()
+		for a, pages := range assets {
+			collected.pages[a] = uniqueStrings(pages)
+		}
+		merged.Assets = collected.refs()
+	}
+
+	return merged
+}
+
+// Checks whether a is a better record of a page than b: a successful fetch
+// beats a failed one, then the one with more links and assets wins
+func richer(a *Page, b *Page) bool {
+	if (a.Error == "") != (b.Error == "") {
+		return a.Error == ""
+	}
+	return len(a.Links)+len(a.Assets) > len(b.Links)+len(b.Assets)
+}
+
+// Adds a sorted, deduplicated group of URLs for a hash to duplicates
+func mergeDuplicates(duplicates map[string][]string, hash string, urls []string) map[string][]string {
+	unique := uniqueStrings(urls)
+	if len(unique) < 2 {
+		return duplicates
+	}
+
+	if duplicates == nil {
+		duplicates = make(map[string][]string)
+	}
+	duplicates[hash] = unique
+	return duplicates
+}
+
+// Sorts strings and drops repeats, reusing the slice
+func uniqueStrings(s []string) []string {
+	sort.Strings(s)
+	unique := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
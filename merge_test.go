@@ -0,0 +1,82 @@
+package gowebcrawler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	deadC := &Page{Url: "/c", Error: "404", Children: map[string]*Page{}}
+	b1 := &Page{Url: "/b", Links: []string{"/c"}, Children: map[string]*Page{}}
+	first := &CrawlResult{
+		Root:       &Page{Url: "/a", Links: []string{"/b", "/c"}, Children: map[string]*Page{"/b": b1, "/c": deadC}},
+		Hosts:      map[string]int{"example.com": 2},
+		DeadLinks:  map[string]string{"/c": "404"},
+		Duplicates: map[string][]string{"x": {"/a", "/e"}},
+		Assets:     []AssetRef{{Url: "/site.css", Count: 1, Pages: []string{"/a"}}},
+	}
+
+	c := &Page{Url: "/c", Assets: []string{"/c.png"}, Children: map[string]*Page{}}
+	d := &Page{Url: "/d", Children: map[string]*Page{}}
+	second := &CrawlResult{
+		Root:       &Page{Url: "/b", Links: []string{"/c", "/d"}, Children: map[string]*Page{"/c": c, "/d": d}},
+		Hosts:      map[string]int{"example.com": 2, "other.com": 1},
+		DeadLinks:  map[string]string{"/e": "500"},
+		Duplicates: map[string][]string{"x": {"/a", "/f"}},
+		Assets: []AssetRef{
+			{Url: "/c.png", Count: 1, Pages: []string{"/c"}},
+			{Url: "/site.css", Count: 2, Pages: []string{"/a", "/b"}},
+		},
+	}
+	third := &CrawlResult{
+		CrawledAt: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Root:      &Page{Url: "/g", Children: map[string]*Page{}},
+		Hosts:     map[string]int{},
+		DeadLinks: map[string]string{},
+	}
+
+	merged := Merge(first, second, nil, third)
+
+	assert.Equal(t, "/a", merged.Root.Url, "First root isn't the merged root")
+	assert.Len(t, merged.Root.Children, 3, "Children length is not 3")
+	assert.Contains(t, merged.Root.Children, "/g", "Unconnected root wasn't added")
+
+	b := merged.Root.Children["/b"]
+	assert.Equal(t, []string{"/c", "/d"}, b.Links, "Didn't keep the richer record of a page")
+	assert.Len(t, b.Children, 1, "Didn't combine the children from each crawl")
+	assert.Contains(t, b.Children, "/d", "Didn't combine the children from each crawl")
+	assert.NotContains(t, b.Children, "/c", "Page appears more than once")
+	assert.Equal(t, "", merged.Root.Children["/c"].Error, "Preferred a failed fetch over a successful one")
+
+	assert.Len(t, merged.Root.Flatten(), 5, "Didn't deduplicate pages")
+	assert.Equal(t, map[string]int{"example.com": 4, "other.com": 1}, merged.Hosts, "Didn't add up the host counts")
+	assert.Equal(t, map[string]string{"/e": "500"}, merged.DeadLinks, "Didn't merge the dead links")
+	assert.Equal(t, map[string][]string{"x": {"/a", "/e", "/f"}}, merged.Duplicates, "Didn't merge the duplicates")
+	assert.Equal(t, []AssetRef{
+		{Url: "/c.png", Count: 1, Pages: []string{"/c"}},
+		{Url: "/site.css", Count: 2, Pages: []string{"/a", "/b"}},
+	}, merged.Assets, "Didn't merge the assets")
+
+	assert.Equal(t, third.CrawledAt, merged.CrawledAt, "Didn't keep the earliest crawl time")
+
+	assert.Equal(t, "404", deadC.Error, "Modified an input")
+	assert.Len(t, first.Root.Children, 2, "Modified an input")
+}
+
+func TestMergeCrawlsLinkingBack(t *testing.T) {
+	a1 := &Page{Url: "/a", Links: []string{"/b"}, Children: map[string]*Page{}}
+	a1.Children["/b"] = &Page{Url: "/b", Children: map[string]*Page{}}
+	b2 := &Page{Url: "/b", Links: []string{"/a"}, Children: map[string]*Page{}}
+	b2.Children["/a"] = &Page{Url: "/a", Children: map[string]*Page{}}
+
+	merged := Merge(&CrawlResult{Root: a1}, &CrawlResult{Root: b2})
+
+	assert.Contains(t, merged.Root.Children, "/b", "Lost the link from the first crawl")
+	assert.Empty(t, merged.Root.Children["/b"].Children, "Linked a page back to its parent")
+	assert.Len(t, merged.Root.Flatten(), 2, "Didn't deduplicate pages")
+
+	j, err := merged.JSON()
+	assert.Nil(t, err, "Got an error from JSON")
+	assert.Equal(t, "/a", jsonToMap(j)["Url"], "Didn't write the merged tree")
+}
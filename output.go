@@ -0,0 +1,560 @@
+package gowebcrawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A FlatPage is a Page without its children, used for flat output
+type FlatPage struct {
+	*Page
+	Children map[string]*Page `json:",omitempty"`
+}
+
+// Crawls from a given URL or path and returns a JSON array of every page,
+// without nesting
+func (w WebCrawler) CrawlFlat(url string) ([]byte, error) {
+	result, err := w.Run(url)
+	if err != nil {
+		return nil, err
+	}
+	return w.output(result).FlatJSON()
+}
+
+// Crawls from a given URL or path and returns the URL of every page fetched,
+// sorted and without duplicates
+func (w WebCrawler) URLs(url string) ([]string, error) {
+	result, err := w.Run(url)
+	if err != nil {
+		return nil, err
+	}
+	return result.URLs(), nil
+}
+
+// Crawls from a given URL or path and streams the same array as CrawlFlat to
+// out, writing each page as soon as it's been crawled instead of holding the
+// whole site map in memory. Pages are written in the order they're crawled
+// and released once written, as with ReleasePages.
+func (w WebCrawler) CrawlFlatTo(url string, out io.Writer) error {
+	w.ReleasePages = true
+	enc := json.NewEncoder(out)
+	var writeErr error
+	written := 0
+
+	write := func(s string) {
+		if writeErr == nil {
+			_, writeErr = io.WriteString(out, s)
+		}
+	}
+
+	write("[")
+	_, err := w.crawl(context.Background(), url, func(p *Page) {
+		if written > 0 {
+			write(",")
+		}
+		if w.RelativeUrls {
+			p = relativePage(p, w.RootUrl)
+		}
+		if writeErr == nil {
+			writeErr = enc.Encode(FlatPage{Page: p})
+		}
+		written++
+	})
+	if err != nil {
+		return err
+	}
+	write("]\n")
+
+	return writeErr
+}
+
+// Crawls from a given URL or path and streams the URL of every page fetched
+// into XML site maps as soon as it's been crawled, split into several files
+// with an index when there are too many for one, see SitemapWriter. The
+// writer's BaseUrl defaults to RootUrl, and its DefaultLastMod to when the
+// crawl started. The writer is closed once the crawl ends.
+func (w WebCrawler) CrawlSitemapTo(url string, sitemaps *SitemapWriter) error {
+	if sitemaps.BaseUrl == "" {
+		sitemaps.BaseUrl = w.RootUrl + "/"
+	}
+	if sitemaps.DefaultLastMod.IsZero() {
+		sitemaps.DefaultLastMod = w.clock().Now()
+	}
+
+	var writeErr error
+	_, err := w.crawl(context.Background(), url, func(p *Page) {
+		if writeErr == nil {
+			writeErr = sitemaps.Add(p)
+		}
+	})
+	closeErr := sitemaps.Close()
+
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return closeErr
+}
+
+// Pages CrawlChan can get ahead of its reader by
+const pageChanBuffer = 16
+
+// Crawls from a given URL or path in the background, sending each page on
+// the returned channel as soon as it's been crawled. Pages are sent without
+// their children, in no guaranteed order. When the reader falls behind by
+// more than a few pages, no new fetches are started until it catches up,
+// so the crawl goes at the reader's pace. The page channel is closed when
+// the crawl ends, after which the error channel gives the crawl's error, if
+// any. The page channel has to be read until it's closed.
+func (w WebCrawler) CrawlChan(url string) (<-chan *Page, <-chan error) {
+	pages := make(chan *Page, pageChanBuffer)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		_, err := w.crawl(context.Background(), url, func(p *Page) {
+			// The crawl keeps adding children to its own copy
+			c := *p
+			c.Children = nil
+			c.parent = nil
+			pages <- &c
+		})
+		close(pages)
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return pages, errs
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"children": sortedChildren,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Site map for {{.Url}}</title>
+</head>
+<body>
+<ul>
+{{template "page" .}}
+</ul>
+</body>
+</html>
+{{define "page"}}<li>
+<details open>
+<summary><a href="{{.Url}}">{{.Url}}</a> ({{len .Assets}} assets)</summary>
+{{with children .}}<ul>
+{{range .}}{{template "page" .}}{{end}}</ul>
+{{end}}</details>
+</li>
+{{end}}`))
+
+// Crawls from a given URL or path and returns the links between the pages
+// crawled as an edge list for graph tools, one "from<TAB>to" line per
+// linked pair of pages. Includes links to pages first reached another way,
+// not just those the tree was built from. Pages are listed in tree order,
+// each page's links sorted.
+func (w WebCrawler) CrawlEdgeList(url string) ([]byte, error) {
+	result, err := w.Run(url)
+	if err != nil {
+		return nil, err
+	}
+	return result.EdgeList(), nil
+}
+
+// Crawls from a given URL or path and returns the same site map as Crawl,
+// written as YAML instead of JSON
+func (w WebCrawler) CrawlYAML(url string) ([]byte, error) {
+	result, err := w.Run(url)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := w.output(result).JSONDepth(w.MaxJSONDepth)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(j)
+}
+
+// Crawls from a given URL or path and renders the site map as an HTML page,
+// with each page's children in a collapsible list
+func (w WebCrawler) CrawlHTML(url string) ([]byte, error) {
+	result, err := w.Run(url)
+	if err != nil {
+		return nil, err
+	}
+	return result.HTML()
+}
+
+// An AssetRef is an asset found during a crawl along with the pages using it
+type AssetRef struct {
+	Url   string
+	Count int
+	Pages []string
+}
+
+// Crawls from a given URL or path and returns a JSON array of every asset
+// found on any page, resolved to an absolute URL without its fragment and
+// sorted, each with the number and sorted URLs of the pages that reference it
+func (w WebCrawler) CrawlAssets(url string) ([]byte, error) {
+	result, err := w.Run(url)
+	if err != nil {
+		return nil, err
+	}
+	return w.output(result).AssetsJSON()
+}
+
+// The methods below render a finished crawl, so one crawl can be written
+// out in as many formats as needed
+
+// JSON renders the page tree as nested JSON, the same as Crawl
+func (r *CrawlResult) JSON() ([]byte, error) {
+	return r.JSONDepth(0)
+}
+
+// A PageRef stands in for a page nested too deep for JSONDepth's output
+type PageRef struct {
+	Ref string
+}
+
+// A page in nested JSON output, with its children cut off at a depth
+type nestedPage struct {
+	*Page
+	Children map[string]interface{}
+}
+
+// JSONDepth renders the page tree as nested JSON like JSON, but only nests
+// pages maxDepth levels below the root. Deeper pages are written as a PageRef
+// with just their URL, so a long chain of pages can't make the output too
+// deep to generate or read back. Unlimited when zero.
+func (r *CrawlResult) JSONDepth(maxDepth int) ([]byte, error) {
+	var root interface{} = r.Root
+	if maxDepth > 0 && r.Root != nil {
+		root = limitDepth(r.Root, 0, maxDepth)
+	}
+
+	b, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error generating JSON Site Map: %s", err)
+	}
+	return b, nil
+}
+
+// Gets a page at depth for marshaling, or a reference to it if it's
+// deeper than maxDepth
+func limitDepth(p *Page, depth int, maxDepth int) interface{} {
+	if depth > maxDepth {
+		return PageRef{Ref: p.Url}
+	}
+
+	nested := nestedPage{Page: p}
+	if p.Children != nil {
+		nested.Children = make(map[string]interface{}, len(p.Children))
+		for u, c := range p.Children {
+			if c != nil {
+				nested.Children[u] = limitDepth(c, depth+1, maxDepth)
+			} else {
+				nested.Children[u] = nil
+			}
+		}
+	}
+	return nested
+}
+
+// YAML renders the page tree as YAML, with the same structure and field
+// names as JSON
+func (r *CrawlResult) YAML() ([]byte, error) {
+	j, err := r.JSON()
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(j)
+}
+
+// Converts JSON to block style YAML, keeping the order of its keys
+func jsonToYAML(j []byte) ([]byte, error) {
+	// JSON is valid YAML, it just needs restyling
+	var doc yaml.Node
+	if err := yaml.Unmarshal(j, &doc); err != nil {
+		return nil, fmt.Errorf("Error generating YAML Site Map: %s", err)
+	}
+	blockStyle(&doc)
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("Error generating YAML Site Map: %s", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("Error generating YAML Site Map: %s", err)
+	}
+	return b.Bytes(), nil
+}
+
+// Clears the flow and quoting styles a node and its children were parsed
+// with, so they're written in YAML's usual style
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// Estimates how many bytes a page at depth adds to the nested JSON output,
+// including its key in its parent's children but not its own children
+func outputSize(p *Page, depth int) int64 {
+	indent := strings.Repeat("  ", 2*depth)
+	b, err := json.MarshalIndent(FlatPage{Page: p}, indent, "  ")
+	if err != nil {
+		return 0
+	}
+	key, _ := json.Marshal(p.Url)
+
+	// `<indent>"url": {...},` plus the `"Children": {}` FlatPage leaves out
+	children := len(",\n") + len(indent) + len(`  "Children": {}`) + len(indent)
+	return int64(len(indent) + len(key) + len(": ") + len(b) + len(",\n") + children)
+}
+
+// FlatJSON renders every page as a JSON array without nesting, the same as CrawlFlat
+func (r *CrawlResult) FlatJSON() ([]byte, error) {
+	pages := r.Root.Flatten()
+	flat := make([]FlatPage, len(pages))
+	for i, p := range pages {
+		flat[i] = FlatPage{Page: p}
+	}
+
+	b, err := json.MarshalIndent(flat, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error generating JSON Site Map: %s", err)
+	}
+	return b, nil
+}
+
+// URLs gets the URL of every page fetched, sorted and without duplicates
+func (r *CrawlResult) URLs() []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, p := range r.Root.Flatten() {
+		if p.Error != "" || seen[p.Url] {
+			continue
+		}
+		seen[p.Url] = true
+		urls = append(urls, p.Url)
+	}
+
+	sort.Strings(urls)
+	return urls
+}
+
+// HTML renders the page tree as an HTML page, the same as CrawlHTML
+func (r *CrawlResult) HTML() ([]byte, error) {
+	var b bytes.Buffer
+	if err := htmlReport.Execute(&b, r.Root); err != nil {
+		return nil, fmt.Errorf("Error generating HTML Site Map: %s", err)
+	}
+	return b.Bytes(), nil
+}
+
+// AssetsJSON renders every asset and the pages using it, the same as
+// CrawlAssets. Uses Assets when it was gathered during the crawl.
+func (r *CrawlResult) AssetsJSON() ([]byte, error) {
+	refs := r.Assets
+	if refs == nil {
+		assets := newAssetCollector()
+		for _, p := range r.Root.Flatten() {
+			assets.add(p)
+		}
+		refs = assets.refs()
+	}
+
+	b, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error generating JSON asset list: %s", err)
+	}
+	return b, nil
+}
+
+// Elements of a sitemaps.org XML site map
+type xmlUrlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Urls    []xmlUrl `xml:"url"`
+}
+
+type xmlUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// XML renders the URL of every page fetched as a sitemaps.org XML site map.
+// Each page's lastmod is its Last-Modified header, or the time of the crawl
+// when it didn't have one.
+func (r *CrawlResult) XML() ([]byte, error) {
+	modified := make(map[string]time.Time)
+	for _, p := range r.Root.Flatten() {
+		if p.LastModified != nil {
+			modified[p.Url] = *p.LastModified
+		}
+	}
+
+	set := xmlUrlSet{Xmlns: sitemapXmlns}
+	for _, u := range r.URLs() {
+		lastMod, ok := modified[u]
+		if !ok {
+			lastMod = r.CrawledAt
+		}
+		set.Urls = append(set.Urls, sitemapEntry(u, lastMod))
+	}
+
+	b, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error generating XML Site Map: %s", err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// DOT renders the links between pages as a Graphviz graph
+func (r *CrawlResult) DOT() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("digraph sitemap {\n")
+	Walk(r.Root, func(_ int, p *Page) bool {
+		fmt.Fprintf(&b, "  %s;\n", dotQuote(p.Url))
+		for _, child := range sortedChildren(p) {
+			fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(p.Url), dotQuote(child.Url))
+		}
+		return true
+	})
+	b.WriteString("}\n")
+	return b.Bytes(), nil
+}
+
+// EdgeList renders every link between crawled pages as a line of
+// "from<TAB>to", the same as CrawlEdgeList
+func (r *CrawlResult) EdgeList() []byte {
+	if r.Root == nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	pages := pagesByUrl(r.Root)
+	for _, p := range r.Root.Flatten() {
+		linked := linkedPages(p, pages)
+		sort.Slice(linked, func(i, j int) bool { return linked[i].Url < linked[j].Url })
+		for _, n := range linked {
+			fmt.Fprintf(&b, "%s\t%s\n", p.Url, n.Url)
+		}
+	}
+	return b.Bytes()
+}
+
+// Gets the result to write out, made relative to RootUrl with RelativeUrls
+func (w WebCrawler) output(r *CrawlResult) *CrawlResult {
+	if w.RelativeUrls {
+		return r.Relative(w.RootUrl)
+	}
+	return r
+}
+
+// Relative gets a copy of the result with the URLs of pages and their links
+// and assets made relative to root when they're under it, e.g. "/about.html"
+// for "https://example.com/about.html" with a root of "https://example.com".
+// URLs elsewhere are left as they are. The result itself isn't modified.
+func (r *CrawlResult) Relative(root string) *CrawlResult {
+	c := *r
+	if r.Root != nil {
+		c.Root = relativeTree(r.Root, root, make(map[*Page]*Page))
+	}
+
+	if r.Assets != nil {
+		c.Assets = make([]AssetRef, len(r.Assets))
+		for i, ref := range r.Assets {
+			c.Assets[i] = AssetRef{Url: relativeUrl(ref.Url, root), Count: ref.Count, Pages: relativeUrls(ref.Pages, root)}
+		}
+	}
+	return &c
+}
+
+// Copies a page and its children with their URLs made relative to root
+func relativeTree(p *Page, root string, copies map[*Page]*Page) *Page {
+	if c, ok := copies[p]; ok {
+		return c
+	}
+
+	c := relativePage(p, root)
+	copies[p] = c
+	for u, child := range p.Children {
+		if child != nil {
+			c.Children[relativeUrl(u, root)] = relativeTree(child, root, copies)
+		} else {
+			c.Children[relativeUrl(u, root)] = nil
+		}
+	}
+	return c
+}
+
+// Copies a page with its URL, links and assets made relative to root and
+// no children
+func relativePage(p *Page, root string) *Page {
+	c := *p
+	c.Url = relativeUrl(p.Url, root)
+	c.Links = relativeUrls(p.Links, root)
+	c.Assets = relativeUrls(p.Assets, root)
+	if p.Children != nil {
+		c.Children = make(map[string]*Page, len(p.Children))
+	}
+	return &c
+}
+
+// Makes each URL under root relative to it, see relativeUrl
+func relativeUrls(urls []string, root string) []string {
+	if urls == nil {
+		return nil
+	}
+	relative := make([]string, len(urls))
+	for i, u := range urls {
+		relative[i] = relativeUrl(u, root)
+	}
+	return relative
+}
+
+// Gets a URL's path, query and fragment when it's under root, or the URL as
+// it is when it isn't
+func relativeUrl(u string, root string) string {
+	root = strings.TrimSuffix(root, "/")
+	if root == "" || !strings.HasPrefix(u, root) {
+		return u
+	}
+
+	rest := u[len(root):]
+	switch {
+	case rest == "":
+		return "/"
+	case strings.HasPrefix(rest, "//"):
+		return u
+	case strings.HasPrefix(rest, "/"):
+		return rest
+	case strings.HasPrefix(rest, "?"), strings.HasPrefix(rest, "#"):
+		return "/" + rest
+	}
+	return u
+}
+
+// Quotes a string as a DOT ID
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,524 @@
+package gowebcrawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCrawlFlat(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	j, err := crawler.CrawlFlat("/circular/1.html")
+
+	assert.Nil(t, err, "Got an error from CrawlFlat")
+
+	pages := jsonToFlatPages(j)
+
+	assert.Len(t, pages, 3, "Didn't get 3 pages")
+	for _, p := range pages {
+		assert.NotContains(t, p, "Children", "Flat page has children")
+	}
+}
+
+func TestCrawlFlatToMatchesCrawlFlat(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	buffered, err := crawler.CrawlFlat("/circular/1.html")
+	assert.Nil(t, err, "Got an error from CrawlFlat")
+
+	var streamed bytes.Buffer
+	err = crawler.CrawlFlatTo("/circular/1.html", &streamed)
+	assert.Nil(t, err, "Got an error from CrawlFlatTo")
+
+	// The order pages arrive in can differ between crawls
+	bufferedPages, streamedPages := jsonToFlatPages(buffered), jsonToFlatPages(streamed.Bytes())
+	for _, p := range append(bufferedPages, streamedPages...) {
+		delete(p, "Seq")
+	}
+
+	assert.Equal(t, bufferedPages, streamedPages, "Streamed pages differ")
+}
+
+func TestCrawlFlatToReleasePages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A chain of 100 pages, each with a sizable body
+		n, _ := strconv.Atoi(strings.Trim(r.URL.Path, "/"))
+		if n < 99 {
+			fmt.Fprintf(w, `<a href="/%d">`, n+1)
+		}
+		w.Write(bytes.Repeat([]byte("<p>Filler</p>"), 1000))
+	}))
+	defer ts.Close()
+
+	// Counts the pages that have been garbage collected
+	crawler := getCrawler(ts.URL)
+	countFreed := func(freed *int32) {
+		crawler.PageHook = func(p *Page) *Page {
+			runtime.SetFinalizer(p, func(*Page) { atomic.AddInt32(freed, 1) })
+			return p
+		}
+	}
+	collect := func(freed *int32) int32 {
+		for i := 0; i < 20 && atomic.LoadInt32(freed) < 90; i++ {
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+		}
+		return atomic.LoadInt32(freed)
+	}
+
+	var freedKept, freedReleased int32
+	countFreed(&freedKept)
+	result, err := crawler.Run("/0")
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, int32(0), collect(&freedKept), "Pages in the tree were released")
+	runtime.KeepAlive(result)
+
+	var streamed bytes.Buffer
+	countFreed(&freedReleased)
+	err = crawler.CrawlFlatTo("/0", &streamed)
+	assert.Nil(t, err, "Got an error from CrawlFlatTo")
+	assert.GreaterOrEqual(t, collect(&freedReleased), int32(90), "Pages weren't released")
+	assert.Len(t, jsonToFlatPages(streamed.Bytes()), 100, "Didn't stream every page")
+}
+
+func TestURLs(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.IncludeFailedPages = true
+
+	urls, err := crawler.URLs("/circular/1.html")
+	assert.Nil(t, err, "Got an error from URLs")
+	assert.Equal(t, []string{
+		fmt.Sprint(ts.URL, "/circular/1.html"),
+		fmt.Sprint(ts.URL, "/circular/2.html"),
+		fmt.Sprint(ts.URL, "/circular/3.html"),
+	}, urls, "Didn't get the right URLs")
+
+	urls, err = crawler.URLs("/dead/1.html")
+	assert.Nil(t, err, "Got an error from URLs")
+	assert.Equal(t, []string{
+		fmt.Sprint(ts.URL, "/dead/1.html"),
+		fmt.Sprint(ts.URL, "/dead/2.html"),
+		fmt.Sprint(ts.URL, "/dead/3.html"),
+	}, urls, "Included a page that couldn't be fetched")
+}
+
+func TestCrawlAssets(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	j, err := crawler.CrawlAssets("/shared_assets/1.html")
+	assert.Nil(t, err, "Got an error from CrawlAssets")
+
+	var refs []AssetRef
+	assert.Nil(t, json.Unmarshal(j, &refs), "Didn't get a JSON asset list")
+
+	one, two := fmt.Sprint(ts.URL, "/shared_assets/1.html"), fmt.Sprint(ts.URL, "/shared_assets/2.html")
+	assert.Equal(t, []AssetRef{
+		{Url: fmt.Sprint(ts.URL, "/shared_assets/app.js"), Count: 1, Pages: []string{two}},
+		{Url: fmt.Sprint(ts.URL, "/shared_assets/logo.png"), Count: 1, Pages: []string{one}},
+		{Url: fmt.Sprint(ts.URL, "/static/site.css"), Count: 2, Pages: []string{one, two}},
+	}, refs, "Didn't get the union of every page's assets")
+}
+
+func TestCrawlResultFormats(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/three/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	j, err := result.JSON()
+	assert.Nil(t, err, "Got an error from JSON")
+	crawled, _ := crawler.Crawl("/three/1.html")
+	assert.Equal(t, jsonToMap(crawled), jsonToMap(j), "JSON doesn't match Crawl")
+
+	*requestCount = 0
+	x, err := result.XML()
+	assert.Nil(t, err, "Got an error from XML")
+	dot, err := result.DOT()
+	assert.Nil(t, err, "Got an error from DOT")
+	assert.Equal(t, 0, *requestCount, "Rendering made requests")
+
+	var set struct {
+		Locs []string `xml:"url>loc"`
+	}
+	assert.Nil(t, xml.Unmarshal(x, &set), "Didn't get valid XML")
+	assert.Equal(t, []string{
+		fmt.Sprint(ts.URL, "/three/1.html"),
+		fmt.Sprint(ts.URL, "/three/2.html"),
+		fmt.Sprint(ts.URL, "/three/3.html"),
+	}, set.Locs, "Didn't list every page in the XML")
+	assert.Contains(t, string(x), `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`, "Not a sitemaps.org site map")
+
+	assert.Equal(t, fmt.Sprintf(`digraph sitemap {
+  "%[1]s/three/1.html";
+  "%[1]s/three/1.html" -> "%[1]s/three/2.html";
+  "%[1]s/three/2.html";
+  "%[1]s/three/2.html" -> "%[1]s/three/3.html";
+  "%[1]s/three/3.html";
+}
+`, ts.URL), string(dot), "Didn't render the DOT graph")
+}
+
+func TestCrawlResultXMLLastMod(t *testing.T) {
+	modified := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			w.Write([]byte(`<a href="/unknown">`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, modified, result.Root.LastModified.UTC(), "Didn't record Last-Modified")
+
+	x, err := result.XML()
+	assert.Nil(t, err, "Got an error from XML")
+
+	var set struct {
+		Urls []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	assert.Nil(t, xml.Unmarshal(x, &set), "Didn't get valid XML")
+	assert.Len(t, set.Urls, 2, "Didn't list every page")
+	assert.Equal(t, "2020-03-04T05:06:07Z", set.Urls[0].LastMod, "Didn't use Last-Modified as lastmod")
+	assert.Equal(t, result.CrawledAt.UTC().Format(time.RFC3339), set.Urls[1].LastMod, "Didn't fall back to the crawl time")
+}
+
+func TestDotQuote(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c"`, dotQuote(`a"b\c`))
+}
+
+func TestCrawlHTML(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	h, err := crawler.CrawlHTML("/three/1.html")
+
+	assert.Nil(t, err, "Got an error from CrawlHTML")
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(h))
+	assert.Nil(t, err, "Couldn't parse the HTML")
+
+	links := doc.Find("details > summary > a").Map(func(_ int, s *goquery.Selection) string {
+		href, _ := s.Attr("href")
+		return href
+	})
+	expected := []string{
+		ts.URL + "/three/1.html",
+		ts.URL + "/three/2.html",
+		ts.URL + "/three/3.html",
+	}
+	assert.Equal(t, expected, links, "Didn't link to every page")
+	assert.Equal(t, 1, doc.Find("details details details").Length(), "Pages aren't nested")
+	assert.Contains(t, doc.Find("summary").Last().Text(), "(1 assets)", "Asset count missing")
+}
+
+func TestCrawlHTMLEscapes(t *testing.T) {
+	page := &Page{Url: `javascript:alert("<b>")`}
+
+	var b bytes.Buffer
+	assert.Nil(t, htmlReport.Execute(&b, page), "Got an error rendering")
+	assert.NotContains(t, b.String(), "<b>", "Didn't escape the URL")
+	assert.NotContains(t, b.String(), `href="javascript:`, "Didn't sanitize the link")
+}
+
+// Decodes a flat JSON site map, sorted by URL since streamed order isn't fixed
+func jsonToFlatPages(j []byte) []map[string]interface{} {
+	var pages []map[string]interface{}
+	json.Unmarshal(j, &pages)
+	sort.Slice(pages, func(a, b int) bool {
+		return pages[a]["Url"].(string) < pages[b]["Url"].(string)
+	})
+	return pages
+}
+
+func TestCrawlMaxJSONDepth(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	unlimited, err := crawler.Crawl("/three/1.html")
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	crawler.MaxJSONDepth = 1
+	j, err := crawler.Crawl("/three/1.html")
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	two := fmt.Sprint(ts.URL, "/three/2.html")
+	three := fmt.Sprint(ts.URL, "/three/3.html")
+	root := jsonToMap(j)
+	child := root["Children"].(map[string]interface{})[two].(map[string]interface{})
+	assert.Equal(t, two, child["Url"], "Page within the limit wasn't nested")
+	assert.Equal(t, map[string]interface{}{
+		three: map[string]interface{}{"Ref": three},
+	}, child["Children"], "Page past the limit wasn't a reference")
+
+	crawler.MaxJSONDepth = 2
+	j, _ = crawler.Crawl("/three/1.html")
+	assert.Equal(t, jsonToMap(unlimited), jsonToMap(j), "Changed a tree within the limit")
+}
+
+func TestJSONDepthDeepChain(t *testing.T) {
+	root := &Page{Url: "/0", Children: map[string]*Page{}}
+	last := root
+	for i := 1; i <= 20000; i++ {
+		next := &Page{Url: fmt.Sprint("/", i), Children: map[string]*Page{}}
+		last.Children[next.Url] = next
+		last = next
+	}
+	result := &CrawlResult{Root: root}
+
+	j, err := result.JSONDepth(100)
+	assert.Nil(t, err, "Got an error from JSONDepth")
+
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(j, &decoded), "Couldn't read back the limited output")
+	assert.Contains(t, string(j), `"Ref": "/101"`, "Deep pages weren't written as references")
+	assert.NotContains(t, string(j), `"/102"`, "Wrote pages past the reference")
+}
+
+func TestCrawlChan(t *testing.T) {
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		} else if n < 50 {
+			fmt.Fprintf(w, `<a href="/%d">`, n+1)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	pages, errs := crawler.CrawlChan("/0")
+
+	// Without a reader the crawl stops once the channel is full
+	time.Sleep(200 * time.Millisecond)
+	assert.LessOrEqual(t, atomic.LoadInt64(&requests), int64(pageChanBuffer+2), "Crawl didn't wait for the reader")
+
+	urls := make(map[string]bool)
+	for p := range pages {
+		time.Sleep(time.Millisecond)
+		assert.Nil(t, p.Children, "Page was sent with children")
+		urls[p.Url] = true
+	}
+	assert.Nil(t, <-errs, "Got an error from the crawl")
+	assert.Len(t, urls, 51, "Didn't get every page")
+
+	pages, errs = crawler.CrawlChan("/missing.html")
+	for range pages {
+	}
+	assert.NotNil(t, <-errs, "Didn't get the crawl's error")
+}
+
+func TestCrawlEdgeList(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	edges, err := crawler.CrawlEdgeList("/circular/1.html")
+	assert.Nil(t, err, "Got an error from CrawlEdgeList")
+
+	one, two, three := ts.URL+"/circular/1.html", ts.URL+"/circular/2.html", ts.URL+"/circular/3.html"
+	expected := strings.Join([]string{
+		one + "\t" + two,
+		one + "\t" + three,
+		two + "\t" + one,
+		two + "\t" + three,
+	}, "\n") + "\n"
+	assert.Equal(t, expected, string(edges), "Didn't get each link between pages once")
+}
+
+func TestCrawlMaxOutputBytes(t *testing.T) {
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		} else if n < 31 {
+			fmt.Fprintf(w, `<a href="/%d"><a href="/%d"><img src="/%d.png">`, 2*n+1, 2*n+2, n)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/0")
+	assert.Nil(t, err, "Got an error from Run")
+	j, err := result.JSON()
+	assert.Nil(t, err, "Got an error from JSON")
+
+	// The estimate shouldn't come in under the real size
+	var estimate int64
+	Walk(result.Root, func(depth int, p *Page) bool {
+		estimate += outputSize(p, depth)
+		return true
+	})
+	assert.GreaterOrEqual(t, estimate, int64(len(j)), "Estimated less than the output size")
+	assert.Less(t, estimate, int64(len(j))*11/10, "Estimate was too far over")
+
+	atomic.StoreInt64(&requests, 0)
+	crawler.MaxOutputBytes = int64(len(j)) / 4
+	j, err = crawler.Crawl("/0")
+
+	assert.Nil(t, err, "Got an error from Crawl")
+	assert.LessOrEqual(t, int64(len(j)), crawler.MaxOutputBytes, "Output went over MaxOutputBytes")
+	assert.Greater(t, len(j), 0, "Didn't return the pages gathered")
+	assert.Less(t, atomic.LoadInt64(&requests), int64(63), "Crawl didn't stop early")
+}
+
+func TestCrawlMaxOutputBytesRetries(t *testing.T) {
+	var flakyRequests int32
+	retried, bigSeen := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/flaky"><a href="/big">`))
+		case "/flaky":
+			if atomic.AddInt32(&flakyRequests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			// Still in flight when the big page is dropped
+			close(retried)
+			<-bigSeen
+		case "/big":
+			<-retried
+			for i := 0; i < 500; i++ {
+				fmt.Fprintf(w, `<a href="/big/%d">`, i)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.MaxRetries = 1
+	crawler.MaxOutputBytes = 2000
+	var once sync.Once
+	crawler.PageHook = func(p *Page) *Page {
+		if strings.HasSuffix(p.Url, "/big") {
+			once.Do(func() { close(bigSeen) })
+		}
+		return p
+	}
+	result, err := crawler.Run("/")
+
+	flaky := fmt.Sprint(ts.URL, "/flaky")
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&flakyRequests), "Didn't retry the page")
+	assert.NotContains(t, result.DeadLinks, flaky, "Failed the retry without trying it")
+	assert.Contains(t, result.Root.Children, flaky, "Retried page was not added")
+	assert.NotContains(t, result.Root.Children, fmt.Sprint(ts.URL, "/big"), "Page over MaxOutputBytes was added")
+}
+
+func TestCrawlRelativeUrls(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.RelativeUrls = true
+	j, err := crawler.Crawl("/three/1.html")
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	m := jsonToMap(j)
+	assert.Equal(t, "/three/1.html", m["Url"], "Page URL wasn't made relative")
+	assert.Contains(t, m["Children"], "/three/2.html", "Child URL wasn't made relative")
+	assert.NotContains(t, string(j), ts.URL, "Output still has absolute URLs")
+
+	j, err = crawler.CrawlAssets("/shared_assets/1.html")
+	assert.Nil(t, err, "Got an error from CrawlAssets")
+	assert.Contains(t, string(j), `"/static/site.css"`, "Asset URL wasn't made relative")
+	assert.NotContains(t, string(j), ts.URL, "Asset output still has absolute URLs")
+
+	var b bytes.Buffer
+	assert.Nil(t, crawler.CrawlFlatTo("/three/1.html", &b), "Got an error from CrawlFlatTo")
+	assert.Contains(t, b.String(), `"/three/1.html"`, "Streamed page URL wasn't made relative")
+	assert.NotContains(t, b.String(), ts.URL, "Streamed output still has absolute URLs")
+
+	// The result itself keeps its absolute URLs
+	result, err := crawler.Run("/three/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+	relative := result.Relative(ts.URL)
+	assert.Equal(t, "/three/1.html", relative.Root.Url, "Relative didn't change the root URL")
+	assert.Equal(t, fmt.Sprint(ts.URL, "/three/1.html"), result.Root.Url, "Relative changed the original result")
+}
+
+func TestRelativeUrl(t *testing.T) {
+	root := "https://example.com"
+	for u, expected := range map[string]string{
+		"https://example.com":              "/",
+		"https://example.com/":             "/",
+		"https://example.com/a/b.html?x=1": "/a/b.html?x=1",
+		"https://example.com?page=2":       "/?page=2",
+		"https://example.com.evil.test/":   "https://example.com.evil.test/",
+		"https://other.example.com/a.html": "https://other.example.com/a.html",
+		"https://example.com//cdn.test/x":  "https://example.com//cdn.test/x",
+		"/already/relative.html":           "/already/relative.html",
+		"mailto:someone@example.com":       "mailto:someone@example.com",
+	} {
+		assert.Equal(t, expected, relativeUrl(u, root), "Wrong relative URL for %s", u)
+		assert.Equal(t, expected, relativeUrl(u, root+"/"), "Root's trailing slash changed %s", u)
+	}
+}
+
+func TestCrawlYAML(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	j, err := crawler.Crawl("/three/1.html")
+	assert.Nil(t, err, "Got an error from Crawl")
+	y, err := crawler.CrawlYAML("/three/1.html")
+	assert.Nil(t, err, "Got an error from CrawlYAML")
+
+	assert.True(t, strings.HasPrefix(string(y), "Url: "+ts.URL), "YAML doesn't start with the root's Url")
+	assert.NotContains(t, string(y), `{"`, "YAML was written in flow style")
+
+	var decoded interface{}
+	assert.Nil(t, yaml.Unmarshal(y, &decoded), "Didn't get valid YAML")
+	roundTrip, err := json.Marshal(decoded)
+	assert.Nil(t, err, "Couldn't turn the YAML back into JSON")
+	assert.JSONEq(t, string(j), string(roundTrip), "YAML didn't have the same structure as the JSON")
+
+	// Strings that look like other types stay strings
+	y, err = jsonToYAML([]byte(`{"Url": "123", "Headers": {"X-Flag": "true", "Empty": ""}, "Links": null}`))
+	assert.Nil(t, err, "Got an error from jsonToYAML")
+	assert.Nil(t, yaml.Unmarshal(y, &decoded), "Didn't get valid YAML")
+	assert.Equal(t, map[string]interface{}{
+		"Url":     "123",
+		"Headers": map[string]interface{}{"X-Flag": "true", "Empty": ""},
+		"Links":   nil,
+	}, decoded, "Types changed going through YAML")
+}
@@ -0,0 +1,33 @@
+package gowebcrawler
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A random number generator that's safe to share between goroutines
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// Gets a lockedRand seeded with seed, or with the time when seed is zero
+func newLockedRand(seed int64) *lockedRand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63n(n)
+}
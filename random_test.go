@@ -0,0 +1,102 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Crawls a page with ten links under Jitter on a fake clock, moving the
+// clock on slowly so pages are requested in the order their delays run out
+func jitteredRequestOrder(t *testing.T, seed int64) []string {
+	var mu sync.Mutex
+	var order []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/" {
+			for i := 0; i < 10; i++ {
+				fmt.Fprintf(w, `<a href="/%d">`, i)
+			}
+			return
+		}
+		order = append(order, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	pending := func() int {
+		clock.mu.Lock()
+		defer clock.mu.Unlock()
+		return len(clock.waiters)
+	}
+	requested := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order)
+	}
+
+	crawler := getCrawler(ts.URL)
+	crawler.Clock = clock
+	crawler.Jitter = time.Hour
+	crawler.RandSeed = seed
+
+	done := make(chan error)
+	go func() {
+		_, err := crawler.Run("/")
+		done <- err
+	}()
+
+	clock.BlockUntil(10)
+	for fired := 0; fired < 10; {
+		before := pending()
+		clock.Advance(time.Second)
+		fired += before - pending()
+
+		// Let each fetch that's due finish before moving on
+		for deadline := time.Now().Add(5 * time.Second); requested() < fired && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	assert.Nil(t, <-done, "Got an error from Run")
+	return order
+}
+
+func TestRandSeedRepeatsJitter(t *testing.T) {
+	first := jitteredRequestOrder(t, 42)
+	assert.Len(t, first, 10, "Didn't fetch every page")
+	assert.Equal(t, first, jitteredRequestOrder(t, 42), "Same seed gave a different order")
+	assert.NotEqual(t, first, jitteredRequestOrder(t, 7), "Different seeds gave the same order")
+}
+
+func TestRandSeedRepeatsUserAgents(t *testing.T) {
+	var mu sync.Mutex
+	var agents []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/1"><a href="/2"><a href="/3"><a href="/4">`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.UserAgents = []string{"a", "b", "c", "d", "e", "f"}
+	crawler.MaxConcurrency = 1
+	crawler.RandSeed = 3
+
+	crawler.Run("/")
+	first := agents
+	agents = nil
+	crawler.Run("/")
+
+	assert.Len(t, first, 5, "Didn't fetch every page")
+	assert.Equal(t, first, agents, "Same seed picked different user agents")
+}
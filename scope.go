@@ -0,0 +1,40 @@
+package gowebcrawler
+
+import (
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Checks whether two URLs are on the same site, meaning their hosts share a
+// registrable domain according to the public suffix list, e.g. www.example.com
+// and example.com but not a.co.uk and b.co.uk. IP addresses only match themselves.
+func sameSite(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	da, db := registrableDomain(ua.Hostname()), registrableDomain(ub.Hostname())
+	return da != "" && da == db
+}
+
+// Gets the domain of a host one level below its public suffix, or the
+// host itself when it's an IP address or has no registrable domain
+func registrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
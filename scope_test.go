@@ -0,0 +1,223 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSameSite(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"http://www.example.com/", "http://example.com/page.html", true},
+		{"http://a.example.com/", "https://b.example.com:8080/", true},
+		{"http://WWW.Example.com/", "http://example.com./", true},
+		{"http://a.co.uk/", "http://b.co.uk/", false},
+		{"http://www.a.co.uk/", "http://a.co.uk/", true},
+		{"http://example.com/", "http://example.org/", false},
+		{"http://127.0.0.1:8080/", "http://127.0.0.1:9090/", true},
+		{"http://127.0.0.1/", "http://127.0.0.2/", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.same, sameSite(test.a, test.b), test.a+" vs "+test.b)
+	}
+}
+
+func TestCrawlSameSite(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "www.example.co.uk" && r.URL.Path == "/" {
+			w.Write([]byte(`<a href="http://blog.example.co.uk/"><a href="http://other.co.uk/">`))
+		}
+	}))
+	defer ts.Close()
+
+	addr := ts.Listener.Addr().String()
+	crawler := getCrawler("http://www.example.co.uk")
+	crawler.HostOverrides = map[string]string{
+		"www.example.co.uk":  addr,
+		"blog.example.co.uk": addr,
+		"other.co.uk":        addr,
+	}
+
+	root := crawlToPage(t, crawler, "/")
+	assert.Len(t, root.Children, 0, "Crawled another host without SameSite")
+
+	crawler.SameSite = true
+	root = crawlToPage(t, crawler, "/")
+	assert.Len(t, root.Children, 1, "Children length is not 1")
+	assert.Contains(t, root.Children, "http://blog.example.co.uk/", "Same site page was not crawled")
+}
+
+func TestCrawlPausesFailingHost(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]time.Time)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.Host+r.URL.Path] = time.Now()
+		mu.Unlock()
+
+		if r.Host == "bad.example.com" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Each good page links to the next one and a page on the failing host,
+		// and is slow enough that the first failures are seen before it's done
+		time.Sleep(20 * time.Millisecond)
+		n := 0
+		if r.URL.Path != "/" {
+			n, _ = strconv.Atoi(r.URL.Path[1:])
+		}
+		if n == 0 {
+			fmt.Fprint(w, `<a href="http://bad.example.com/a">`)
+		}
+		if n < 3 {
+			fmt.Fprintf(w, `<a href="http://bad.example.com/%d"><a href="/%d">`, n, n+1)
+		}
+	}))
+	defer ts.Close()
+
+	addr := ts.Listener.Addr().String()
+	crawler := getCrawler("http://www.example.com")
+	crawler.SameSite = true
+	crawler.HostOverrides = map[string]string{"www.example.com": addr, "bad.example.com": addr}
+	crawler.HostErrorThreshold = 2
+	crawler.HostCooldown = 300 * time.Millisecond
+
+	start := time.Now()
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Len(t, result.DeadLinks, 4, "Didn't try every page on the failing host")
+	assert.Len(t, requested, 8, "Didn't fetch every page")
+
+	paused := requested["bad.example.com/1"]
+	assert.GreaterOrEqual(t, paused.Sub(start), crawler.HostCooldown, "Failing host wasn't paused")
+	for i := 1; i <= 3; i++ {
+		assert.True(t, requested[fmt.Sprint("www.example.com/", i)].Before(paused), "Healthy host didn't keep going")
+	}
+}
+
+func TestCrawlMaxHosts(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.Host+r.URL.Path] = true
+		mu.Unlock()
+
+		switch r.Host + r.URL.Path {
+		case "www.example.com/":
+			w.Write([]byte(`<a href="http://a.example.com/"><a href="http://b.example.com/"><a href="http://c.example.com/">`))
+		case "a.example.com/":
+			w.Write([]byte(`<a href="http://www.example.com/more"><a href="/more"><a href="http://c.example.com/more">`))
+		}
+	}))
+	defer ts.Close()
+
+	addr := ts.Listener.Addr().String()
+	crawler := getCrawler("http://www.example.com")
+	crawler.SameSite = true
+	crawler.MaxHosts = 2
+	crawler.HostOverrides = map[string]string{
+		"www.example.com": addr,
+		"a.example.com":   addr,
+		"b.example.com":   addr,
+		"c.example.com":   addr,
+	}
+
+	_, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]bool{
+		"www.example.com/":     true,
+		"a.example.com/":       true,
+		"www.example.com/more": true,
+		"a.example.com/more":   true,
+	}, requested, "Didn't stop at two hosts")
+}
+
+func TestCrawlMaxHostsOnlyCountsQueuedLinks(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.Host+r.URL.Path] = true
+		mu.Unlock()
+
+		if r.Host == "www.example.com" {
+			w.Write([]byte(`<a href="http://a.example.com/"><a href="http://b.example.com/">`))
+		}
+	}))
+	defer ts.Close()
+
+	addr := ts.Listener.Addr().String()
+	crawler := getCrawler("http://www.example.com")
+	crawler.SameSite = true
+	crawler.MaxHosts = 2
+	crawler.PreVisited = []string{"http://a.example.com/"}
+	crawler.HostOverrides = map[string]string{
+		"www.example.com": addr,
+		"a.example.com":   addr,
+		"b.example.com":   addr,
+	}
+
+	_, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, map[string]bool{
+		"www.example.com/": true,
+		"b.example.com/":   true,
+	}, requested, "A link that wasn't queued used up a host")
+}
+
+func TestCrawlHostErrorThresholdUsesRetryableFunc(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]time.Time)
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.Host+r.URL.Path] = clock.Now()
+		mu.Unlock()
+
+		switch r.Host + r.URL.Path {
+		case "www.example.com/":
+			w.Write([]byte(`<a href="http://bad.example.com/a"><a href="/1">`))
+		case "www.example.com/1":
+			w.Write([]byte(`<a href="http://bad.example.com/b">`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	addr := ts.Listener.Addr().String()
+	crawler := getCrawler("http://www.example.com")
+	crawler.SameSite = true
+	crawler.HostOverrides = map[string]string{"www.example.com": addr, "bad.example.com": addr}
+	crawler.Clock = clock
+	crawler.MaxConcurrency = 1
+	crawler.HostErrorThreshold = 1
+	crawler.HostCooldown = time.Hour
+	crawler.RetryableFunc = func(statusCode int, err error) bool {
+		return statusCode == http.StatusNotFound
+	}
+
+	// The second page on the failing host waits out the cooldown
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+	}()
+	_, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, time.Hour, requested["bad.example.com/b"].Sub(requested["bad.example.com/a"]), "Failing host wasn't paused")
+}
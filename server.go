@@ -0,0 +1,94 @@
+package gowebcrawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ServeHTTP runs a crawl and responds with its JSON site map, so a WebCrawler
+// can be used as an HTTP service. The crawl is configured by the WebCrawler
+// with these request parameters (query string or form body):
+//
+//	url        - path or URL to start from (required). When the crawler has
+//	             no RootUrl, the scheme and host of this URL are used.
+//	fetchLimit - lower the fetch limit for this crawl
+//	maxBytes   - lower the download limit for this crawl
+//
+// Limits from the request can only tighten the crawler's own. The crawl is
+// cancelled if the client goes away.
+func (w WebCrawler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	seed := r.FormValue("url")
+	if seed == "" {
+		http.Error(rw, "Missing url parameter", http.StatusBadRequest)
+		return
+	}
+
+	if w.RootUrl == "" {
+		u, err := url.Parse(seed)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			http.Error(rw, "url must be absolute when the crawler has no RootUrl", http.StatusBadRequest)
+			return
+		}
+		w.RootUrl = u.Scheme + "://" + u.Host
+	}
+
+	if w.Parser == nil {
+		w.Parser = &UrlParser{}
+	}
+
+	fetchLimit, err := limitParam(r, "fetchLimit", int64(w.FetchLimit))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.FetchLimit = int(fetchLimit)
+
+	if w.MaxTotalBytes, err = limitParam(r, "maxBytes", w.MaxTotalBytes); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := w.RunContext(r.Context(), seed)
+	if r.Context().Err() != nil {
+		// Nobody is listening for the response
+		return
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// Encoded in full first, so a failure can still be reported
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result.Root); err != nil {
+		http.Error(rw, fmt.Sprintf("Error generating JSON Site Map: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	body.WriteTo(rw)
+}
+
+// Gets a limit from a request parameter, which can only lower a non-zero current limit
+func limitParam(r *http.Request, name string, current int64) (int64, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return current, nil
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("Invalid %s parameter: %q", name, value)
+	}
+
+	if current != 0 && current < limit {
+		return current, nil
+	}
+	return limit, nil
+}
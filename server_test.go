@@ -0,0 +1,105 @@
+package gowebcrawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestServeHTTP(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	service := httptest.NewServer(WebCrawler{})
+	defer service.Close()
+
+	form := url.Values{
+		"url":        {fmt.Sprint(ts.URL, "/three/1.html")},
+		"fetchLimit": {"2"},
+	}
+	res, err := http.PostForm(service.URL, form)
+	assert.Nil(t, err, "Got an error posting the crawl request")
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode, "Crawl request failed")
+
+	var root Page
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&root), "Couldn't decode the site map")
+	assert.Equal(t, fmt.Sprint(ts.URL, "/three/1.html"), root.Url, "Did not get the expected URL")
+	assert.Len(t, root.Flatten(), 2, "Didn't respect the fetch limit")
+	assert.Equal(t, 2, *requestCount, "Didn't make the right amount of requests")
+}
+
+func TestServeHTTPRejectsBadRequests(t *testing.T) {
+	crawler := WebCrawler{RootUrl: "http://example.com", FetchLimit: 5}
+
+	for _, query := range []string{"", "url=/&fetchLimit=lots", "url=/&maxBytes=-1"} {
+		rw := httptest.NewRecorder()
+		crawler.ServeHTTP(rw, httptest.NewRequest("GET", "/?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rw.Code, "Didn't reject %q", query)
+	}
+}
+
+func TestServeHTTPReportsEncodingErrors(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	// A page that's its own child can't be written as JSON
+	crawler := getCrawler(ts.URL)
+	crawler.PageHook = func(p *Page) *Page {
+		p.Children[p.Url] = p
+		return p
+	}
+
+	rw := httptest.NewRecorder()
+	crawler.ServeHTTP(rw, httptest.NewRequest("GET", "/?url=/three/3.html", nil))
+	assert.Equal(t, http.StatusInternalServerError, rw.Code, "Didn't report the encoding error")
+	assert.Contains(t, rw.Body.String(), "Error generating JSON Site Map", "Didn't say what went wrong")
+}
+
+func TestLimitParamOnlyLowersLimits(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?fetchLimit=10", nil)
+
+	limit, _ := limitParam(r, "fetchLimit", 5)
+	assert.Equal(t, int64(5), limit, "Raised the crawler's limit")
+
+	limit, _ = limitParam(r, "fetchLimit", 20)
+	assert.Equal(t, int64(10), limit, "Didn't lower the crawler's limit")
+
+	limit, _ = limitParam(r, "fetchLimit", 0)
+	assert.Equal(t, int64(10), limit, "Didn't set an unlimited crawler's limit")
+}
+
+func TestRunContextCancelStopsCrawl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/slow">`))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	crawler := getCrawler(ts.URL)
+	crawler.PageHook = func(p *Page) *Page {
+		cancel()
+		return p
+	}
+
+	start := time.Now()
+	result, err := crawler.RunContext(ctx, "/")
+
+	assert.Equal(t, context.Canceled, err, "Didn't get the context's error")
+	assert.NotNil(t, result, "Didn't get a partial result")
+	assert.Less(t, time.Since(start), 2*time.Second, "Crawl didn't stop when cancelled")
+}
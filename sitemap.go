@@ -0,0 +1,206 @@
+package gowebcrawler
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on a single sitemaps.org site map file
+const (
+	DefaultSitemapMaxUrls  = 50000
+	DefaultSitemapMaxBytes = 50 * 1024 * 1024
+)
+
+const sitemapXmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// A SitemapWriter streams pages into sitemaps.org XML site maps as they're
+// crawled, without holding the site map in memory. The first file is
+// sitemap.xml. When a file would go over MaxUrls or MaxBytes, it's closed and
+// the rest go into sitemap-2.xml, sitemap-3.xml and so on, with a
+// sitemap_index.xml listing every file written when Close is called. Only
+// pages fetched successfully are written, each URL once. It's safe for
+// concurrent use.
+type SitemapWriter struct {
+	// Opens each file to write, given its name
+	Create func(name string) (io.WriteCloser, error)
+
+	// URL the files will be served from, which the index's file names are
+	// resolved against, e.g. "https://example.com/"
+	BaseUrl string
+
+	// Most URLs and bytes to put in each file, DefaultSitemapMaxUrls and
+	// DefaultSitemapMaxBytes when zero
+	MaxUrls  int
+	MaxBytes int64
+
+	// lastmod for pages without a Last-Modified header, left out when zero
+	DefaultLastMod time.Time
+
+	mu     sync.Mutex
+	files  []string
+	out    io.WriteCloser
+	urls   int
+	bytes  int64
+	seen   map[string]bool
+	closed bool
+	err    error
+}
+
+const sitemapFooter = "</urlset>\n"
+
+// Add writes a page's URL to the current file, starting a new one first
+// if it's full. Pages that failed or were already added are skipped.
+func (s *SitemapWriter) Add(p *Page) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("Site map writer is closed")
+	}
+	if s.err != nil || p.Error != "" || s.seen[p.Url] {
+		return s.err
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	s.seen[p.Url] = true
+
+	lastMod := s.DefaultLastMod
+	if p.LastModified != nil {
+		lastMod = *p.LastModified
+	}
+	entry, err := xml.MarshalIndent(sitemapEntry(p.Url, lastMod), "  ", "  ")
+	if err != nil {
+		s.err = fmt.Errorf("Error generating XML Site Map: %s", err)
+		return s.err
+	}
+	entry = append(append([]byte("  "), entry...), '\n')
+
+	full := s.urls >= s.maxUrls() || s.bytes+int64(len(entry)+len(sitemapFooter)) > s.maxBytes()
+	if s.out == nil || (full && s.urls > 0) {
+		if s.err = s.next(); s.err != nil {
+			return s.err
+		}
+	}
+
+	s.write(entry)
+	s.urls++
+	return s.err
+}
+
+// Close finishes the current file, and writes the index when the site map
+// was split into more than one. Calling it again does nothing.
+func (s *SitemapWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+
+	// An empty site map is still written
+	if s.out == nil && s.err == nil {
+		s.err = s.next()
+	}
+	if s.out != nil {
+		s.finish()
+	}
+	if s.err != nil || len(s.files) < 2 {
+		return s.err
+	}
+
+	index, err := s.Create("sitemap_index.xml")
+	if err != nil {
+		s.err = err
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, "<sitemapindex xmlns=\"%s\">\n", sitemapXmlns)
+	for _, name := range s.files {
+		b.WriteString("  <sitemap>\n    <loc>")
+		xml.EscapeText(&b, []byte(resolveUrl(s.BaseUrl, name)))
+		b.WriteString("</loc>\n  </sitemap>\n")
+	}
+	b.WriteString("</sitemapindex>\n")
+
+	if _, err := io.WriteString(index, b.String()); err != nil {
+		index.Close()
+		s.err = err
+		return err
+	}
+	s.err = index.Close()
+	return s.err
+}
+
+// Finishes the current file, if any, and starts the next
+func (s *SitemapWriter) next() error {
+	if s.out != nil {
+		if s.finish(); s.err != nil {
+			return s.err
+		}
+	}
+
+	name := "sitemap.xml"
+	if len(s.files) > 0 {
+		name = fmt.Sprintf("sitemap-%d.xml", len(s.files)+1)
+	}
+	out, err := s.Create(name)
+	if err != nil {
+		return err
+	}
+
+	s.files = append(s.files, name)
+	s.out, s.urls, s.bytes = out, 0, 0
+	s.write([]byte(fmt.Sprintf("%s<urlset xmlns=\"%s\">\n", xml.Header, sitemapXmlns)))
+	return s.err
+}
+
+// Writes the closing tag of the current file and closes it
+func (s *SitemapWriter) finish() {
+	s.write([]byte(sitemapFooter))
+	if err := s.out.Close(); s.err == nil {
+		s.err = err
+	}
+	s.out = nil
+}
+
+// Writes to the current file, keeping the first error
+func (s *SitemapWriter) write(b []byte) {
+	if s.err != nil {
+		return
+	}
+	n, err := s.out.Write(b)
+	s.bytes += int64(n)
+	s.err = err
+}
+
+func (s *SitemapWriter) maxUrls() int {
+	if s.MaxUrls > 0 {
+		return s.MaxUrls
+	}
+	return DefaultSitemapMaxUrls
+}
+
+func (s *SitemapWriter) maxBytes() int64 {
+	if s.MaxBytes > 0 {
+		return s.MaxBytes
+	}
+	return DefaultSitemapMaxBytes
+}
+
+// Gets the site map entry for a URL, without a lastmod when it's zero
+func sitemapEntry(u string, lastMod time.Time) xmlUrl {
+	entry := xmlUrl{Loc: u}
+	if !lastMod.IsZero() {
+		entry.LastMod = lastMod.UTC().Format(time.RFC3339)
+	}
+	return entry
+}
@@ -0,0 +1,135 @@
+package gowebcrawler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// An in-memory file for SitemapWriter.Create
+type sitemapFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *sitemapFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+// Makes a SitemapWriter that keeps its files in memory
+func memorySitemaps() (*SitemapWriter, map[string]*sitemapFile) {
+	files := make(map[string]*sitemapFile)
+	return &SitemapWriter{Create: func(name string) (io.WriteCloser, error) {
+		files[name] = &sitemapFile{}
+		return files[name], nil
+	}}, files
+}
+
+// Gets the locs in a site map or site map index
+func sitemapLocs(t *testing.T, b []byte) []string {
+	var doc struct {
+		Entries []struct {
+			Loc string `xml:"loc"`
+		} `xml:",any"`
+	}
+	assert.Nil(t, xml.Unmarshal(b, &doc), "Didn't write valid XML")
+
+	var locs []string
+	for _, e := range doc.Entries {
+		locs = append(locs, e.Loc)
+	}
+	return locs
+}
+
+func TestCrawlSitemapTo(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/dead/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+	x, err := result.XML()
+	assert.Nil(t, err, "Got an error from XML")
+
+	sitemaps, files := memorySitemaps()
+	assert.Nil(t, crawler.CrawlSitemapTo("/dead/1.html", sitemaps), "Got an error from CrawlSitemapTo")
+
+	assert.Len(t, files, 1, "Split a small site map")
+	if f := files["sitemap.xml"]; assert.NotNil(t, f, "Didn't write sitemap.xml") {
+		assert.True(t, f.closed, "Didn't close the file")
+		assert.True(t, strings.HasPrefix(f.String(), xml.Header), "Didn't write the XML header")
+		locs := sitemapLocs(t, f.Bytes())
+		sort.Strings(locs)
+		assert.NotEmpty(t, locs, "Didn't write any URLs")
+		assert.Equal(t, sitemapLocs(t, x), locs, "Didn't write the same URLs as XML")
+	}
+}
+
+func TestCrawlSitemapToSplitsPastUrlLimit(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	sitemaps, files := memorySitemaps()
+	sitemaps.MaxUrls = 2
+	assert.Nil(t, crawler.CrawlSitemapTo("/three/1.html", sitemaps), "Got an error from CrawlSitemapTo")
+
+	assert.Len(t, files, 3, "Didn't split the site map")
+	assert.Len(t, sitemapLocs(t, files["sitemap.xml"].Bytes()), 2, "Went over MaxUrls")
+	assert.Len(t, sitemapLocs(t, files["sitemap-2.xml"].Bytes()), 1, "Didn't put the rest in the next file")
+
+	index := files["sitemap_index.xml"]
+	if assert.NotNil(t, index, "Didn't write an index") {
+		assert.Contains(t, index.String(), "<sitemapindex", "Index isn't a site map index")
+		assert.Equal(t, []string{
+			fmt.Sprint(ts.URL, "/sitemap.xml"),
+			fmt.Sprint(ts.URL, "/sitemap-2.xml"),
+		}, sitemapLocs(t, index.Bytes()), "Index doesn't list every file")
+	}
+}
+
+func TestSitemapWriterLimits(t *testing.T) {
+	sitemaps, files := memorySitemaps()
+	sitemaps.BaseUrl = "https://example.com/maps/"
+	for i := 0; i <= DefaultSitemapMaxUrls; i++ {
+		assert.Nil(t, sitemaps.Add(&Page{Url: fmt.Sprintf("https://example.com/%d", i)}))
+	}
+	assert.Nil(t, sitemaps.Add(&Page{Url: "https://example.com/0"}), "Got an error adding a repeat")
+	assert.Nil(t, sitemaps.Add(&Page{Url: "https://example.com/failed", Error: "404"}), "Got an error adding a failed page")
+	assert.Nil(t, sitemaps.Close(), "Got an error from Close")
+	assert.Nil(t, sitemaps.Close(), "Got an error closing again")
+
+	assert.Len(t, sitemapLocs(t, files["sitemap.xml"].Bytes()), DefaultSitemapMaxUrls, "Didn't fill the first file")
+	assert.Equal(t, []string{"https://example.com/50000"}, sitemapLocs(t, files["sitemap-2.xml"].Bytes()), "Didn't split past the URL limit")
+	assert.Equal(t, []string{
+		"https://example.com/maps/sitemap.xml",
+		"https://example.com/maps/sitemap-2.xml",
+	}, sitemapLocs(t, files["sitemap_index.xml"].Bytes()), "Index doesn't list every file")
+	assert.NotNil(t, sitemaps.Add(&Page{Url: "https://example.com/late"}), "Added a page after Close")
+
+	modified := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	sitemaps, files = memorySitemaps()
+	sitemaps.MaxBytes = 400
+	sitemaps.DefaultLastMod = modified
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, sitemaps.Add(&Page{Url: fmt.Sprintf("https://example.com/%d", i)}))
+	}
+	assert.Nil(t, sitemaps.Close(), "Got an error from Close")
+
+	assert.Greater(t, len(files), 2, "Didn't split past the size limit")
+	for name, f := range files {
+		assert.LessOrEqual(t, f.Len(), 400, "%s went over MaxBytes", name)
+	}
+	assert.Contains(t, files["sitemap.xml"].String(), "<lastmod>2024-03-01T12:00:00Z</lastmod>", "Didn't use DefaultLastMod")
+
+	sitemaps, files = memorySitemaps()
+	assert.Nil(t, sitemaps.Close(), "Got an error closing an empty site map")
+	assert.Empty(t, sitemapLocs(t, files["sitemap.xml"].Bytes()), "Empty site map has URLs")
+}
@@ -0,0 +1,49 @@
+package gowebcrawler
+
+// How a page's URL was found, recorded in Page.Source when
+// WebCrawler.RecordSources is set
+const (
+	SourceSeed        = "seed"
+	SourceLink        = "link"
+	SourceArea        = "area"
+	SourceForm        = "form"
+	SourceJSONLD      = "jsonld"
+	SourceMetaRefresh = "meta-refresh"
+	SourcePagination  = "pagination"
+	SourceCanonical   = "canonical"
+	SourceLinkHeader  = "link-header"
+	SourceRedirect    = "redirect"
+)
+
+// Adds links found some way other than an <a> to a page, noting how they
+// were found when sources are being recorded
+func (u UrlParser) addLinks(page *Page, source string, links ...string) {
+	page.Links = append(page.Links, links...)
+	u.noteSources(page, source, links)
+}
+
+// Notes how a page's links were found when sources are being recorded. A
+// link found more than one way keeps the first.
+func (u UrlParser) noteSources(page *Page, source string, links []string) {
+	if !u.recordSources {
+		return
+	}
+
+	if page.linkSources == nil {
+		page.linkSources = make(map[string]string)
+	}
+	for _, l := range links {
+		if _, ok := page.linkSources[l]; !ok {
+			page.linkSources[l] = source
+		}
+	}
+}
+
+// Gets how a link on a page was found from its link sources, SourceLink
+// for a plain <a>
+func linkSource(sources map[string]string, link string) string {
+	if source, ok := sources[link]; ok {
+		return source
+	}
+	return SourceLink
+}
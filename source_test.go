@@ -0,0 +1,70 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrawlRecordsSources(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Link", `</header-next>; rel="next"`)
+			w.Write([]byte(`<html><head>
+<link rel="canonical" href="/canonical">
+<link rel="next" href="/page-2">
+<meta http-equiv="refresh" content="5; url=/refreshed">
+<script type="application/ld+json">{"url": "/structured", "author": {"url": "/anchor"}}</script>
+</head><body>
+<a href=" /anchor ">Anchor</a>
+<a href="/missing">Missing</a>
+<a href="/moved">Moved</a>
+<a href="/both">Both</a>
+<map><area href="/area"><area href="/both"></map>
+<form action="/search"></form>
+</body></html>`))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/moved":
+			http.Redirect(w, r, "/landing", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.CleanUrls = true
+	crawler.Parser.FollowAreaLinks = true
+	crawler.Parser.FollowFormActions = true
+	crawler.Parser.FollowCanonical = true
+	crawler.Parser.FollowMetaRefresh = true
+	crawler.Parser.FollowPagination = true
+	crawler.Parser.ParseJSONLD = true
+	crawler.IncludeFailedPages = true
+	root := crawlToPage(t, crawler, "/")
+	assert.Empty(t, root.Source, "Recorded sources by default")
+
+	crawler.RecordSources = true
+	root = crawlToPage(t, crawler, "/")
+
+	assert.Equal(t, SourceSeed, root.Source, "Wrong source for the seed")
+	sources := make(map[string]string)
+	for u, c := range root.Children {
+		sources[u] = c.Source
+	}
+	assert.Equal(t, map[string]string{
+		fmt.Sprint(ts.URL, "/anchor"):      SourceLink,
+		fmt.Sprint(ts.URL, "/missing"):     SourceLink,
+		fmt.Sprint(ts.URL, "/moved"):       SourceRedirect,
+		fmt.Sprint(ts.URL, "/both"):        SourceLink,
+		fmt.Sprint(ts.URL, "/area"):        SourceArea,
+		fmt.Sprint(ts.URL, "/search"):      SourceForm,
+		fmt.Sprint(ts.URL, "/canonical"):   SourceCanonical,
+		fmt.Sprint(ts.URL, "/page-2"):      SourcePagination,
+		fmt.Sprint(ts.URL, "/refreshed"):   SourceMetaRefresh,
+		fmt.Sprint(ts.URL, "/structured"):  SourceJSONLD,
+		fmt.Sprint(ts.URL, "/header-next"): SourceLinkHeader,
+	}, sources, "Wrong sources")
+}
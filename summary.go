@@ -0,0 +1,29 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Summary reports whether a crawl found no problems, along with a sorted
+// line for each one: pages that couldn't be fetched, and assets that failed
+// validation when ValidateAssets was set. Only fetches that were attempted
+// count, so links to other sites or mailto: links aren't failures. It's
+// meant for CI checks that should fail on broken links.
+func (r *CrawlResult) Summary() (ok bool, failures []string) {
+	for u, reason := range r.DeadLinks {
+		failures = append(failures, fmt.Sprintf("%s: %s", u, reason))
+	}
+
+	for u, status := range r.AssetStatus {
+		switch {
+		case status == 0:
+			failures = append(failures, fmt.Sprintf("%s: Asset couldn't be fetched", u))
+		case status >= 400:
+			failures = append(failures, fmt.Sprintf("%s: Got a %d status code for asset", u, status))
+		}
+	}
+
+	sort.Strings(failures)
+	return len(failures) == 0, failures
+}
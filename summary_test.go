@@ -0,0 +1,72 @@
+package gowebcrawler
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/three/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	ok, failures := result.Summary()
+	assert.True(t, ok, "Crawl without failures wasn't ok")
+	assert.Empty(t, failures, "Got failures for a healthy crawl")
+
+	result, err = crawler.Run("/broken_links/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	ok, failures = result.Summary()
+	assert.False(t, ok, "Crawl with dead links was ok")
+	assert.Equal(t, []string{
+		fmt.Sprintf("%s/broken_links/missing1.html: Got a 404 status code when getting URL [%s/broken_links/missing1.html]", ts.URL, ts.URL),
+		fmt.Sprintf("%s/broken_links/missing2.html: Got a 404 status code when getting URL [%s/broken_links/missing2.html]", ts.URL, ts.URL),
+	}, failures, "Didn't list the dead links")
+}
+
+func TestSummaryIgnoresSkippedLinks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="https://www.example.org/"><a href="mailto:a@b.c"><a href="/missing">`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+
+	ok, failures := result.Summary()
+	assert.False(t, ok, "Crawl with a dead link was ok")
+	if assert.Len(t, failures, 1, "Counted skipped links as failures") {
+		assert.Contains(t, failures[0], fmt.Sprint(ts.URL, "/missing"), "Didn't list the dead link")
+	}
+}
+
+func TestSummaryIncludesBrokenAssets(t *testing.T) {
+	result := &CrawlResult{
+		DeadLinks: map[string]string{},
+		AssetStatus: map[string]int{
+			"http://example.com/ok.css":      200,
+			"http://example.com/missing.png": 404,
+			"http://example.com/down.js":     0,
+		},
+	}
+
+	ok, failures := result.Summary()
+	assert.False(t, ok, "Crawl with broken assets was ok")
+	assert.Equal(t, []string{
+		"http://example.com/down.js: Asset couldn't be fetched",
+		"http://example.com/missing.png: Got a 404 status code for asset",
+	}, failures, "Didn't list the broken assets")
+}
@@ -0,0 +1,81 @@
+package gowebcrawler
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings breaks down how long fetching a page took. Stages that didn't
+// happen, like DNS for an IP address or connecting on a reused connection,
+// are zero. Redirects add up across every request made.
+type Timings struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+
+	// From the start of the request to the first byte of the response
+	FirstByte time.Duration
+}
+
+// Collects Timings from httptrace hooks, which can be called from
+// more than one goroutine
+type timingTrace struct {
+	mu      sync.Mutex
+	timings Timings
+
+	start, dnsStart, connectStart, tlsStart time.Time
+}
+
+// Gets a ClientTrace that records into t
+func (t *timingTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mark(&t.start)
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mark(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.add(&t.timings.DNS, &t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mark(&t.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.add(&t.timings.Connect, &t.connectStart)
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.add(&t.timings.TLSHandshake, &t.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			t.add(&t.timings.FirstByte, &t.start)
+		},
+	}
+}
+
+// Sets a start time to now
+func (t *timingTrace) mark(start *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*start = time.Now()
+}
+
+// Adds the time since start to a stage's duration
+func (t *timingTrace) add(d *time.Duration, start *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*d += time.Since(*start)
+}
+
+// Gets a copy of the timings recorded so far
+func (t *timingTrace) result() *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := t.timings
+	return &timings
+}
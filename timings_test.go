@@ -0,0 +1,42 @@
+package gowebcrawler
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParsePageTraceTimings(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="/next.html">`))
+	}))
+	defer ts.Close()
+
+	// Go through localhost so there's a DNS lookup to time
+	pageUrl := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	parser := UrlParser{Client: &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}}
+
+	page, err := parser.ParsePage(pageUrl)
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Nil(t, page.Timings, "Recorded timings by default")
+
+	// A new client so the connection isn't reused
+	parser.Client = &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	parser.TraceTimings = true
+	page, err = parser.ParsePage(pageUrl)
+	assert.Nil(t, err, "Got an error from ParsePage")
+
+	if assert.NotNil(t, page.Timings, "Didn't record timings") {
+		assert.Greater(t, int64(page.Timings.DNS), int64(0), "DNS time wasn't recorded")
+		assert.Greater(t, int64(page.Timings.Connect), int64(0), "Connect time wasn't recorded")
+		assert.Greater(t, int64(page.Timings.TLSHandshake), int64(0), "TLS handshake time wasn't recorded")
+		assert.Greater(t, int64(page.Timings.FirstByte), int64(0), "Time to first byte wasn't recorded")
+	}
+}
@@ -0,0 +1,49 @@
+package gowebcrawler
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// TLSInfo describes the TLS connection a page was served over
+type TLSInfo struct {
+	// Negotiated protocol version, e.g. "TLS 1.3"
+	Version string
+
+	// When the server's certificate expires, and who it was issued to and by
+	CertExpiry  time.Time
+	CertSubject string
+	CertIssuer  string
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// Gets the name of a TLS version, e.g. "TLS 1.2"
+func tlsVersionName(version uint16) string {
+	if name, ok := tlsVersions[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// Gets the TLSInfo for a connection, nil if it wasn't over TLS
+func tlsInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{Version: tlsVersionName(state.Version)}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		info.CertExpiry = cert.NotAfter
+		info.CertSubject = cert.Subject.String()
+		info.CertIssuer = cert.Issuer.String()
+	}
+	return info
+}
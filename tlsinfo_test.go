@@ -0,0 +1,38 @@
+package gowebcrawler
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePageCapturesTLSInfo(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="/next.html">`))
+	}))
+	defer ts.Close()
+
+	parser := UrlParser{Client: ts.Client()}
+	page, err := parser.ParsePage(ts.URL)
+	assert.Nil(t, err, "Got an error from ParsePage")
+	assert.Nil(t, page.TLS, "Captured TLS info by default")
+
+	parser.CaptureTLSInfo = true
+	page, err = parser.ParsePage(ts.URL)
+	assert.Nil(t, err, "Got an error from ParsePage")
+
+	if assert.NotNil(t, page.TLS, "Didn't capture TLS info") {
+		cert := ts.Certificate()
+		assert.Equal(t, "TLS 1.3", page.TLS.Version, "Wrong TLS version")
+		assert.Equal(t, cert.NotAfter, page.TLS.CertExpiry, "Wrong certificate expiry")
+		assert.Equal(t, cert.Subject.String(), page.TLS.CertSubject, "Wrong certificate subject")
+	}
+}
+
+func TestTLSInfoVersions(t *testing.T) {
+	assert.Nil(t, tlsInfo(nil), "Got TLS info without TLS")
+	assert.Equal(t, "TLS 1.2", tlsInfo(&tls.ConnectionState{Version: tls.VersionTLS12}).Version)
+	assert.Equal(t, "0x0999", tlsInfo(&tls.ConnectionState{Version: 0x0999}).Version)
+}
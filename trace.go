@@ -0,0 +1,40 @@
+package gowebcrawler
+
+import (
+	"errors"
+)
+
+// Decisions recorded in a TraceEntry
+const (
+	TraceFetched         = "fetched"
+	TraceFailed          = "failed"
+	TraceSkippedExternal = "skipped-external"
+	TraceSkippedRobots   = "skipped-robots"
+	TraceSkippedFilter   = "skipped-filter"
+	TraceSkippedLimit    = "skipped-limit"
+)
+
+// A TraceEntry records what a crawl with WebCrawler.Trace set decided to do
+// with a URL it came across, and why
+type TraceEntry struct {
+	Url      string
+	Decision string
+	Reason   string `json:",omitempty"`
+}
+
+// Returned by checkUrl for URLs outside of the crawl's scope
+type scopeError string
+
+func (e scopeError) Error() string {
+	return string(e)
+}
+
+// Gets the decision for a fetch that failed with err: skipped when the URL
+// was never in scope, failed otherwise
+func traceDecision(err error) string {
+	var scopeErr scopeError
+	if errors.As(err, &scopeErr) || errors.Is(err, ErrUnsupportedScheme) {
+		return TraceSkippedExternal
+	}
+	return TraceFailed
+}
@@ -0,0 +1,88 @@
+package gowebcrawler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCrawlTrace(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`
+				<a href="/a"></a>
+				<a href="/nofollow"></a>
+				<a href="http://other.org/"></a>
+				<a href="/filtered"></a>
+				<a href="/missing"></a>
+				<a href="http://blog.example.com/"></a>
+			`))
+		case "/a":
+			w.Write([]byte(`<a href="/"></a>`))
+		case "/nofollow":
+			w.Write([]byte(`<meta name="robots" content="nofollow"><a href="/hidden"></a>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	addr := ts.Listener.Addr().String()
+	crawler := getCrawler("http://www.example.com")
+	crawler.HostOverrides = map[string]string{"www.example.com": addr, "blog.example.com": addr}
+	crawler.SameSite = true
+	crawler.MaxHosts = 1
+	crawler.RespectMetaRobots = true
+	crawler.ShouldFetch = func(url string, depth int, parent *Page) bool {
+		return !strings.Contains(url, "filtered")
+	}
+
+	result, err := crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Nil(t, result.Trace, "Traced without Trace")
+
+	crawler.Trace = true
+	result, err = crawler.Run("/")
+	assert.Nil(t, err, "Got an error from Run")
+
+	decisions := make(map[string]string)
+	reasons := make(map[string]string)
+	for _, e := range result.Trace {
+		assert.NotContains(t, decisions, e.Url, "URL traced twice")
+		decisions[e.Url] = e.Decision
+		reasons[e.Url] = e.Reason
+	}
+
+	assert.Equal(t, map[string]string{
+		"http://www.example.com/":         TraceFetched,
+		"http://www.example.com/a":        TraceFetched,
+		"http://www.example.com/nofollow": TraceFetched,
+		"http://other.org/":               TraceSkippedExternal,
+		"http://www.example.com/filtered": TraceSkippedFilter,
+		"http://www.example.com/missing":  TraceFailed,
+		"http://blog.example.com/":        TraceSkippedLimit,
+		"http://www.example.com/hidden":   TraceSkippedRobots,
+	}, decisions, "Wrong decisions")
+	assert.Equal(t, "MaxHosts reached", reasons["http://blog.example.com/"], "Wrong reason for the limit")
+	assert.Contains(t, reasons["http://www.example.com/missing"], "404", "Failure reason doesn't say why")
+	assert.Equal(t, "", reasons["http://www.example.com/"], "Fetched page has a reason")
+}
+
+func TestCrawlTraceStoppedByLimit(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.Trace = true
+	crawler.FetchLimit = 1
+	result, err := crawler.Run("/three/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	assert.Equal(t, []TraceEntry{
+		{Url: ts.URL + "/three/1.html", Decision: TraceFetched},
+		{Url: ts.URL + "/three/2.html", Decision: TraceSkippedLimit, Reason: "FetchLimit reached"},
+	}, result.Trace, "Queued link wasn't traced as skipped")
+}
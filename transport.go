@@ -0,0 +1,260 @@
+package gowebcrawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Gets a copy of the parser with its client set up for the crawl's options,
+// or the parser itself when there's nothing to set up
+func (w WebCrawler) crawlParser() *UrlParser {
+	if w.Prepare == nil && len(w.HostOverrides) == 0 && w.TokenProvider == nil &&
+		w.MinTLSVersion == 0 && w.DigestUsername == "" && w.ResponseHeaderTimeout == 0 &&
+		!w.BlockOffDomainRedirects {
+		return w.Parser
+	}
+
+	parser := *w.Parser
+	client := http.Client{}
+	if parser.Client != nil {
+		client = *parser.Client
+	}
+
+	if w.Prepare != nil && client.Jar == nil {
+		client.Jar, _ = cookiejar.New(nil)
+	}
+
+	if w.BlockOffDomainRedirects {
+		client.CheckRedirect = w.checkRedirect(client.CheckRedirect)
+	}
+
+	if len(w.HostOverrides) > 0 {
+		client.Transport = overrideHosts(client.Transport, w.HostOverrides)
+	}
+
+	if w.ResponseHeaderTimeout > 0 {
+		client.Transport = headerTimeout(client.Transport, w.ResponseHeaderTimeout)
+	}
+
+	if w.MinTLSVersion != 0 {
+		client.Transport = requireTLSVersion(client.Transport, w.MinTLSVersion)
+	}
+
+	if w.DigestUsername != "" {
+		client.Transport = &digestTransport{base: client.Transport, username: w.DigestUsername, password: w.DigestPassword}
+	}
+
+	if w.TokenProvider != nil {
+		client.Transport = &tokenTransport{base: client.Transport, provider: w.TokenProvider}
+	}
+
+	parser.Client = &client
+	return &parser
+}
+
+// Wraps a client's redirect policy so redirects leaving the allowed domain
+// fail with ErrOffDomainRedirect. Without a policy to wrap, Go's default of
+// stopping after 10 redirects is kept.
+func (w WebCrawler) checkRedirect(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if err := w.checkDomain(req.URL.String()); err != nil {
+			return fmt.Errorf("%w: %v", ErrOffDomainRedirect, req.URL)
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// Wraps a transport so it dials overridden addresses. Only *http.Transport (or
+// the default nil transport) can be changed, anything else is returned as is.
+func overrideHosts(rt http.RoundTripper, overrides map[string]string) http.RoundTripper {
+	t := cloneTransport(rt)
+	if t == nil {
+		return rt
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, overrideAddr(addr, overrides))
+	}
+	return t
+}
+
+// Gets a copy of a transport we can configure, nil if it isn't an *http.Transport
+func cloneTransport(rt http.RoundTripper) *http.Transport {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return nil
+	}
+	return t.Clone()
+}
+
+// Sets how long a transport waits for response headers. Only *http.Transport
+// (or the default nil transport) can be changed, anything else is returned as is.
+func headerTimeout(rt http.RoundTripper, d time.Duration) http.RoundTripper {
+	t := cloneTransport(rt)
+	if t == nil {
+		return rt
+	}
+	t.ResponseHeaderTimeout = d
+	return t
+}
+
+// Wraps a transport so it won't use a TLS version older than min. An
+// *http.Transport (or the default nil transport) is set to refuse them
+// during the handshake, other transports are checked once they respond.
+func requireTLSVersion(rt http.RoundTripper, min uint16) http.RoundTripper {
+	if t := cloneTransport(rt); t != nil {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		} else {
+			t.TLSClientConfig = t.TLSClientConfig.Clone()
+		}
+		if t.TLSClientConfig.MinVersion < min {
+			t.TLSClientConfig.MinVersion = min
+		}
+		rt = t
+	}
+	return &tlsVersionTransport{base: rt, min: min}
+}
+
+// A tlsVersionTransport fails requests with ErrTLSVersion when the server
+// can't agree a TLS version of at least min
+type tlsVersionTransport struct {
+	base http.RoundTripper
+	min  uint16
+}
+
+func (t *tlsVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		if isTLSVersionError(err) {
+			return nil, fmt.Errorf("%w (%s): %v", ErrTLSVersion, tlsVersionName(t.min), err)
+		}
+		return nil, err
+	}
+
+	if res.TLS != nil && res.TLS.Version < t.min {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w (%s): server used %s", ErrTLSVersion, tlsVersionName(t.min), tlsVersionName(res.TLS.Version))
+	}
+	return res, nil
+}
+
+// Checks whether a handshake failed because client and server couldn't
+// agree on a protocol version, whichever side gave up
+func isTLSVersionError(err error) bool {
+	// The server sends a protocol_version alert
+	var alert tls.AlertError
+	if errors.As(err, &alert) && alert == 70 {
+		return true
+	}
+	return strings.Contains(err.Error(), "protocol version")
+}
+
+// Swaps a host:port dial address for its override, if there is one
+func overrideAddr(addr string, overrides map[string]string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	target, ok := overrides[addr]
+	if !ok {
+		if target, ok = overrides[host]; !ok {
+			return addr
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(target, port)
+}
+
+// A tokenTransport sends each request with a bearer token from provider. The
+// token is cached and only replaced when a request using it gets a 401.
+type tokenTransport struct {
+	base     http.RoundTripper
+	provider func() (string, error)
+
+	mu    sync.Mutex
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.get("")
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.send(req, token)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// A body that's been sent can't be sent again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return res, nil
+	}
+	res.Body.Close()
+
+	// The token has probably expired, so try once more with a new one
+	if token, err = t.get(token); err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		req = req.Clone(req.Context())
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.send(req, token)
+}
+
+// Gets the cached token, asking the provider for a new one when there's
+// none yet or it's still the stale one. Concurrent requests that find the
+// same token stale only cause one refresh.
+func (t *tokenTransport) get(stale string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && t.token != stale {
+		return t.token, nil
+	}
+
+	token, err := t.provider()
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	return token, nil
+}
+
+// Sends a copy of a request with the token attached
+func (t *tokenTransport) send(req *http.Request, token string) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,224 @@
+package gowebcrawler
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrawlUsesHostOverrides(t *testing.T) {
+	var hosts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/child.html">`))
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler("http://staging.example.test")
+	crawler.HostOverrides = map[string]string{"staging.example.test": ts.Listener.Addr().String()}
+
+	root := crawlToPage(t, crawler, "/")
+
+	assert.Equal(t, "http://staging.example.test/", root.Url, "Did not get the expected URL")
+	assert.Contains(t, root.Children, "http://staging.example.test/child.html", "Child page was not crawled")
+	assert.Equal(t, []string{"staging.example.test", "staging.example.test"}, hosts, "Requests didn't keep the original host")
+}
+
+func TestCrawlRefreshesBearerToken(t *testing.T) {
+	var mu sync.Mutex
+	valid, uses, issued := "", 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Tokens expire after two requests
+		if r.Header.Get("Authorization") != "Bearer "+valid || uses >= 2 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		uses++
+
+		body, _ := ioutil.ReadFile(path.Join(BasePath, r.URL.Path))
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.TokenProvider = func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		issued++
+		valid, uses = fmt.Sprint("token-", issued), 0
+		return valid, nil
+	}
+
+	result, err := crawler.Run("/duplicates/start.html")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Empty(t, result.DeadLinks, "Some pages couldn't be fetched")
+	assert.Len(t, result.Root.Children, 3, "Children length is not 3")
+	assert.Equal(t, 2, issued, "Didn't reuse and refresh the token")
+}
+
+func TestCrawlTokenProviderError(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.TokenProvider = func() (string, error) {
+		return "", errors.New("No token")
+	}
+
+	_, err := crawler.Crawl("/three/1.html")
+	assert.NotNil(t, err, "Didn't fail without a token")
+	assert.Equal(t, 0, *requestCount, "Sent a request without a token")
+}
+
+func TestOverrideAddr(t *testing.T) {
+	overrides := map[string]string{
+		"example.com":     "10.0.0.1",
+		"example.com:443": "10.0.0.2:8443",
+		"other.com":       "10.0.0.3:8080",
+	}
+
+	assert.Equal(t, "10.0.0.1:80", overrideAddr("example.com:80", overrides))
+	assert.Equal(t, "10.0.0.2:8443", overrideAddr("example.com:443", overrides))
+	assert.Equal(t, "10.0.0.3:8080", overrideAddr("other.com:80", overrides))
+	assert.Equal(t, "unknown.com:80", overrideAddr("unknown.com:80", overrides))
+}
+
+func TestCrawlMinTLSVersion(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<p>Old server</p>`))
+	}))
+	ts.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := ts.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.MinVersion = tls.VersionTLS10
+
+	crawler := getCrawler(ts.URL)
+	crawler.Parser.Client = client
+	_, err := crawler.Run("/")
+	assert.Nil(t, err, "Couldn't crawl the old server without MinTLSVersion")
+
+	crawler.MinTLSVersion = tls.VersionTLS12
+	_, err = crawler.Run("/")
+	assert.True(t, errors.Is(err, ErrTLSVersion), "Didn't refuse the old TLS version: %v", err)
+	assert.Contains(t, fmt.Sprint(err), "TLS 1.2", "Error doesn't say which version was needed")
+	assert.Equal(t, uint16(tls.VersionTLS10), client.Transport.(*http.Transport).TLSClientConfig.MinVersion, "Changed the caller's client")
+}
+
+func TestTLSVersionTransportChecksResponse(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// Not an *http.Transport, so only the response can be checked
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return ts.Client().Transport.RoundTrip(req)
+	})
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := requireTLSVersion(base, tls.VersionTLS12).RoundTrip(req)
+	assert.Nil(t, err, "Refused a new enough TLS version")
+	res.Body.Close()
+
+	_, err = requireTLSVersion(base, 0xffff).RoundTrip(req)
+	assert.True(t, errors.Is(err, ErrTLSVersion), "Didn't check the response's TLS version")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCrawlResponseHeaderTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/hung"><a href="/large">`))
+		case "/hung":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		case "/large":
+			// Headers straight away, then a body that takes a while
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for i := 0; i < 5; i++ {
+				time.Sleep(40 * time.Millisecond)
+				w.Write([]byte(`<p>More content</p>`))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.ResponseHeaderTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Less(t, time.Since(start), 2*time.Second, "Didn't give up on the hung server")
+	assert.Contains(t, result.DeadLinks, fmt.Sprint(ts.URL, "/hung"), "Hung page wasn't abandoned")
+	assert.Contains(t, result.Root.Children, fmt.Sprint(ts.URL, "/large"), "Slow body was cut off")
+}
+
+func TestCrawlBlocksOffDomainRedirects(t *testing.T) {
+	external := 0
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		external++
+		w.Write([]byte(`<a href="/elsewhere">`))
+	}))
+	defer other.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/moved"><a href="/old">`))
+		case "/moved":
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	moved := fmt.Sprint(ts.URL, "/moved")
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 1, external, "Didn't follow the redirect by default")
+	assert.Contains(t, result.Root.Children, moved, "Redirected page was not crawled")
+
+	external = 0
+	crawler.BlockOffDomainRedirects = true
+	result, err = crawler.Run("/")
+
+	assert.Nil(t, err, "Got an error from Run")
+	assert.Equal(t, 0, external, "Followed the redirect off the domain")
+	assert.Contains(t, result.DeadLinks[moved], ErrOffDomainRedirect.Error(), "Didn't record the rejected redirect")
+	assert.Contains(t, result.DeadLinks[moved], other.URL+"/landing", "Didn't record where it redirected to")
+	assert.Contains(t, result.Root.Children, fmt.Sprint(ts.URL, "/old"), "Didn't follow the redirect on the domain")
+
+	_, err = crawler.Parser.ParsePage(moved)
+	assert.Nil(t, err, "Changed the parser's own client")
+}
@@ -0,0 +1,117 @@
+package gowebcrawler
+
+import (
+	"sort"
+)
+
+// Walk does a depth-first traversal of the tree rooted at root, calling fn
+// with each page and its depth (the root is at depth 0). When fn returns false
+// the page's children are skipped. Each page is visited at most once, so
+// shared or cyclic structures are safe to walk.
+func Walk(root *Page, fn func(depth int, p *Page) bool) {
+	seen := make(map[*Page]bool)
+
+	var visit func(depth int, page *Page)
+	visit = func(depth int, page *Page) {
+		if page == nil || seen[page] {
+			return
+		}
+		seen[page] = true
+
+		if !fn(depth, page) {
+			return
+		}
+
+		for _, child := range sortedChildren(page) {
+			visit(depth+1, child)
+		}
+	}
+	visit(0, root)
+}
+
+// Flatten returns every unique page in the tree rooted at p, root first.
+// Pages reachable by more than one path are only returned once.
+func (p *Page) Flatten() []*Page {
+	var pages []*Page
+	Walk(p, func(_ int, page *Page) bool {
+		pages = append(pages, page)
+		return true
+	})
+	return pages
+}
+
+// ComputeClickDepths sets each page's ClickDepth to the fewest links that
+// have to be followed to get to it from the root, and returns them by URL.
+// The tree only records whichever path reached a page first, which isn't
+// always the shortest, so this searches every link between crawled pages.
+func (r *CrawlResult) ComputeClickDepths() map[string]int {
+	depths := make(map[string]int)
+	if r.Root == nil {
+		return depths
+	}
+
+	pages := pagesByUrl(r.Root)
+	depths[r.Root.Url] = 0
+	queue := []*Page{r.Root}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		p.ClickDepth = depths[p.Url]
+
+		for _, n := range linkedPages(p, pages) {
+			if _, ok := depths[n.Url]; !ok {
+				depths[n.Url] = depths[p.Url] + 1
+				queue = append(queue, n)
+			}
+		}
+	}
+	return depths
+}
+
+// Gets every page in the tree rooted at root by URL
+func pagesByUrl(root *Page) map[string]*Page {
+	pages := make(map[string]*Page)
+	for _, p := range root.Flatten() {
+		pages[p.Url] = p
+	}
+	return pages
+}
+
+// Gets the crawled pages a page links to, without repeats, in the order
+// they're linked to followed by any other children
+func linkedPages(p *Page, pages map[string]*Page) []*Page {
+	var linked []*Page
+	seen := make(map[*Page]bool)
+	add := func(n *Page) {
+		if n != nil && !seen[n] {
+			seen[n] = true
+			linked = append(linked, n)
+		}
+	}
+
+	for _, l := range p.Links {
+		add(pages[resolveUrl(p.Url, l)])
+	}
+
+	// Children are linked to from the page too, but may have been found
+	// through a link that resolves differently, e.g. a redirect
+	for _, c := range sortedChildren(p) {
+		add(c)
+	}
+	return linked
+}
+
+// Gets a page's children ordered by URL so traversals are repeatable
+func sortedChildren(p *Page) []*Page {
+	urls := make([]string, 0, len(p.Children))
+	for u := range p.Children {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	children := make([]*Page, 0, len(urls))
+	for _, u := range urls {
+		children = append(children, p.Children[u])
+	}
+	return children
+}
@@ -0,0 +1,128 @@
+package gowebcrawler
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFlattenThreeLevels(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	root := crawlToPage(t, getCrawler(ts.URL), "/three/1.html")
+	pages := root.Flatten()
+
+	assert.Len(t, pages, 3, "Didn't flatten to 3 pages")
+	assert.Equal(t, root, pages[0], "Root page wasn't first")
+}
+
+func TestFlattenSkipsSharedPages(t *testing.T) {
+	shared := &Page{Url: "/shared", Children: map[string]*Page{}}
+	left := &Page{Url: "/left", Children: map[string]*Page{"/shared": shared}}
+	right := &Page{Url: "/right", Children: map[string]*Page{"/shared": shared}}
+	root := &Page{Url: "/", Children: map[string]*Page{"/left": left, "/right": right}}
+
+	pages := root.Flatten()
+
+	assert.Equal(t, []*Page{root, left, shared, right}, pages, "Didn't flatten each page once")
+}
+
+func TestWalkCollectsUrlsAtDepth(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	root := crawlToPage(t, getCrawler(ts.URL), "/three/1.html")
+
+	var urls []string
+	Walk(root, func(depth int, p *Page) bool {
+		if depth == 1 {
+			urls = append(urls, p.Url)
+		}
+		return true
+	})
+
+	assert.Equal(t, []string{ts.URL + "/three/2.html"}, urls, "Didn't collect the URLs at depth 1")
+}
+
+func TestWalkPrunesAndHandlesCycles(t *testing.T) {
+	a := &Page{Url: "/a", Children: map[string]*Page{}}
+	b := &Page{Url: "/b", Children: map[string]*Page{"/a": a}}
+	c := &Page{Url: "/c", Children: map[string]*Page{}}
+	a.Children["/b"] = b
+	a.Children["/c"] = c
+	c.Children["/d"] = &Page{Url: "/d"}
+
+	var visited []string
+	Walk(a, func(depth int, p *Page) bool {
+		visited = append(visited, p.Url)
+		return p.Url != "/c"
+	})
+
+	assert.Equal(t, []string{"/a", "/b", "/c"}, visited, "Didn't walk each page once or prune the branch")
+}
+
+// Crawls from a path and decodes the JSON site map back into a Page tree
+func crawlToPage(t *testing.T, crawler WebCrawler, path string) *Page {
+	j, err := crawler.Crawl(path)
+	assert.Nil(t, err, "Got an error from Crawl")
+
+	var root Page
+	assert.Nil(t, json.Unmarshal(j, &root), "Couldn't decode the site map")
+	return &root
+}
+
+func TestComputeClickDepths(t *testing.T) {
+	// The crawl reached /d through /a and /x first, but /b links to it directly
+	//
+	//        /
+	//      /   \
+	//    /a     /b
+	//     |      |
+	//    /x      |
+	//      \    /
+	//        /d
+	d := &Page{Url: "http://example.com/d", Children: map[string]*Page{}}
+	x := &Page{Url: "http://example.com/x", Links: []string{"/d"}, Children: map[string]*Page{"http://example.com/d": d}}
+	a := &Page{Url: "http://example.com/a", Links: []string{"x"}, Children: map[string]*Page{"http://example.com/x": x}}
+	b := &Page{Url: "http://example.com/b", Links: []string{"/d", "http://other.com/"}, Children: map[string]*Page{}}
+	root := &Page{
+		Url:      "http://example.com/",
+		Links:    []string{"/a", "/b"},
+		Children: map[string]*Page{"http://example.com/a": a, "http://example.com/b": b},
+	}
+	result := &CrawlResult{Root: root}
+
+	depths := result.ComputeClickDepths()
+
+	assert.Equal(t, map[string]int{
+		"http://example.com/":  0,
+		"http://example.com/a": 1,
+		"http://example.com/b": 1,
+		"http://example.com/x": 2,
+		"http://example.com/d": 2,
+	}, depths, "Didn't find the shortest paths")
+	assert.Equal(t, 2, d.ClickDepth, "Page's ClickDepth wasn't set from the shortest path")
+	assert.Equal(t, 1, b.ClickDepth, "Page's ClickDepth wasn't set")
+
+	depth := -1
+	Walk(root, func(n int, p *Page) bool {
+		if p == d {
+			depth = n
+		}
+		return true
+	})
+	assert.Equal(t, 3, depth, "Tree path should be longer than the shortest path")
+}
+
+func TestComputeClickDepthsFromCrawl(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	result, err := getCrawler(ts.URL).Run("/three/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	depths := result.ComputeClickDepths()
+	assert.Equal(t, 2, depths[ts.URL+"/three/3.html"], "Wrong depth for a crawled page")
+	assert.Len(t, depths, 3, "Didn't get every page")
+}
@@ -0,0 +1,114 @@
+package gowebcrawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Visited tracks which URLs a crawl has already seen, so each is only
+// fetched once. Implementations must be safe for concurrent use, and can
+// be swapped in for bounded, persistent or shared stores.
+type Visited interface {
+	// Marks a URL as seen, returning true if it hadn't been seen before
+	MarkSeen(url string) (firstTime bool)
+}
+
+// MemoryVisited is the default in-memory Visited store. The zero value is
+// ready to use.
+type MemoryVisited struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (m *MemoryVisited) MarkSeen(url string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seen == nil {
+		m.seen = make(map[string]bool)
+	}
+	if m.seen[url] {
+		return false
+	}
+	m.seen[url] = true
+	return true
+}
+
+// LoadVisited reads the page URLs from a previous crawl's output, for use as
+// WebCrawler.PreVisited. It accepts a JSON site map from Crawl or JSONDepth,
+// a flat one from CrawlFlat, or a plain list with one URL per line.
+func LoadVisited(r io.Reader) ([]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(b)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var root loadedPage
+		if err := json.Unmarshal(trimmed, &root); err != nil {
+			return nil, err
+		}
+		return root.urls(nil), nil
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var pages []*Page
+		if err := json.Unmarshal(trimmed, &pages); err != nil {
+			return nil, err
+		}
+		return pageUrls(pages), nil
+	}
+
+	var urls []string
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	return urls, scanner.Err()
+}
+
+// A page read back from a JSON site map, which is a PageRef with just Ref set
+// for pages nested too deep for JSONDepth
+type loadedPage struct {
+	Url      string
+	Ref      string
+	Children map[string]*loadedPage
+}
+
+// Appends the URL of the page and every page below it, root first
+func (p *loadedPage) urls(urls []string) []string {
+	if p.Url != "" {
+		urls = append(urls, p.Url)
+	} else if p.Ref != "" {
+		urls = append(urls, p.Ref)
+	}
+
+	keys := make([]string, 0, len(p.Children))
+	for u, c := range p.Children {
+		if c != nil {
+			keys = append(keys, u)
+		}
+	}
+	sort.Strings(keys)
+	for _, u := range keys {
+		urls = p.Children[u].urls(urls)
+	}
+	return urls
+}
+
+// Gets the URL of each page
+func pageUrls(pages []*Page) []string {
+	urls := make([]string, len(pages))
+	for i, p := range pages {
+		urls[i] = p.Url
+	}
+	return urls
+}
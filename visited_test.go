@@ -0,0 +1,109 @@
+package gowebcrawler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// Visited store that records every URL it's asked about
+type recordingVisited struct {
+	seen  map[string]bool
+	calls []string
+}
+
+func (r *recordingVisited) MarkSeen(url string) bool {
+	r.calls = append(r.calls, url)
+	if r.seen[url] {
+		return false
+	}
+	r.seen[url] = true
+	return true
+}
+
+func TestCrawlUsesCustomVisited(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	visited := &recordingVisited{seen: map[string]bool{
+		fmt.Sprint(ts.URL, "/circular/3.html"): true,
+	}}
+
+	crawler := getCrawler(ts.URL)
+	crawler.Visited = visited
+	root := crawlToPage(t, crawler, "/circular/1.html")
+
+	assert.Equal(t, 2, *requestCount, "Didn't make the right amount of requests")
+	assert.Len(t, root.Flatten(), 2, "Crawled a page the store had already seen")
+	assert.Contains(t, visited.calls, fmt.Sprint(ts.URL, "/circular/1.html"), "Seed wasn't marked")
+	assert.Len(t, visited.calls, 6, "Store wasn't asked about every link")
+}
+
+func TestCrawlSkipsPreVisited(t *testing.T) {
+	ts, requestCount := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	crawler.PreVisited = []string{"/circular/1.html", fmt.Sprint(ts.URL, "/circular/2.html")}
+	root := crawlToPage(t, crawler, "/circular/1.html")
+
+	assert.Equal(t, 2, *requestCount, "Didn't make the right amount of requests")
+	assert.Len(t, root.Children, 1, "Children length is not 1")
+	assert.Contains(t, root.Children, fmt.Sprint(ts.URL, "/circular/3.html"), "New page was not crawled")
+}
+
+func TestLoadVisited(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	expected := []string{
+		fmt.Sprint(ts.URL, "/three/1.html"),
+		fmt.Sprint(ts.URL, "/three/2.html"),
+		fmt.Sprint(ts.URL, "/three/3.html"),
+	}
+
+	tree, _ := crawler.Crawl("/three/1.html")
+	urls, err := LoadVisited(bytes.NewReader(tree))
+	assert.Nil(t, err, "Got an error loading a site map")
+	assert.Equal(t, expected, urls, "Didn't load the site map's URLs")
+
+	flat, _ := crawler.CrawlFlat("/three/1.html")
+	urls, err = LoadVisited(bytes.NewReader(flat))
+	assert.Nil(t, err, "Got an error loading a flat site map")
+	assert.Equal(t, expected, urls, "Didn't load the flat site map's URLs")
+
+	urls, err = LoadVisited(strings.NewReader("\n" + strings.Join(expected, "\n") + "\n\n"))
+	assert.Nil(t, err, "Got an error loading a URL list")
+	assert.Equal(t, expected, urls, "Didn't load the listed URLs")
+}
+
+func TestLoadVisitedDepthLimited(t *testing.T) {
+	ts, _ := createTestServer()
+	defer ts.Close()
+
+	crawler := getCrawler(ts.URL)
+	result, err := crawler.Run("/three/1.html")
+	assert.Nil(t, err, "Got an error from Run")
+
+	j, err := result.JSONDepth(1)
+	assert.Nil(t, err, "Got an error from JSONDepth")
+	assert.Contains(t, string(j), `"Ref"`, "Didn't cut off the deepest page")
+
+	urls, err := LoadVisited(bytes.NewReader(j))
+	assert.Nil(t, err, "Got an error loading a depth limited site map")
+	assert.Equal(t, []string{
+		fmt.Sprint(ts.URL, "/three/1.html"),
+		fmt.Sprint(ts.URL, "/three/2.html"),
+		fmt.Sprint(ts.URL, "/three/3.html"),
+	}, urls, "Didn't load the URLs of cut off pages")
+}
+
+func TestMemoryVisited(t *testing.T) {
+	var visited MemoryVisited
+
+	assert.True(t, visited.MarkSeen("http://example.com/"), "First visit wasn't reported")
+	assert.False(t, visited.MarkSeen("http://example.com/"), "Repeat visit was reported")
+}